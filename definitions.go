@@ -2,15 +2,25 @@ package plinko
 
 import (
 	"context"
+	"reflect"
+	"time"
 )
 
 type State string
 type Trigger string
 
+// CompletionTrigger is the trigger reported for automatic transitions declared with PermitAuto and
+// PermitAutoIf, which are taken without a trigger being fired.
+const CompletionTrigger Trigger = "Completion"
+
+// Predicate guards a permit.  CanFire, Explain and EnumerateActiveTriggersContext evaluate it without trigger
+// arguments, so a predicate must tolerate an empty GetArgs.
 type Predicate func(context.Context, Payload, TransitionInfo) error
 type TriggerPredicate func(context.Context, Payload, TransitionInfo) bool
 type Operation func(context.Context, Payload, TransitionInfo) (Payload, error)
 type ErrorOperation func(context.Context, Payload, ModifiableTransitionInfo, error) (Payload, error)
+type DestinationSelector func(context.Context, Payload) (State, error)
+type UnhandledTriggerHandler func(context.Context, Payload, Trigger) error
 
 type StateDefinition interface {
 	//State() string
@@ -20,38 +30,86 @@ type StateDefinition interface {
 	OnTriggerEntry(Trigger, Operation, ...OperationOption) StateDefinition
 	OnTriggerExit(Trigger, Operation, ...OperationOption) StateDefinition
 	Permit(Trigger, State) StateDefinition
-	PermitIf(Predicate, Trigger, State) StateDefinition
+	PermitIf(Predicate, Trigger, State, ...OperationOption) StateDefinition
+	PermitDynamic(Trigger, DestinationSelector, []State, ...OperationOption) StateDefinition
 	PermitReentry(Trigger) StateDefinition
-	PermitReentryIf(Predicate, Trigger) StateDefinition
+	PermitReentryIf(Predicate, Trigger, ...OperationOption) StateDefinition
+	InternalTransition(Trigger, Operation, ...OperationOption) StateDefinition
+	Ignore(Trigger) StateDefinition
+	PermitAuto(State) StateDefinition
+	PermitAutoIf(Predicate, State, ...OperationOption) StateDefinition
+	SubstateOf(State) StateDefinition
+	Terminal() StateDefinition
 }
 
 type StateMachine interface {
 	Fire(context.Context, Payload, Trigger) (Payload, error)
+	FireWithArgs(context.Context, Payload, Trigger, ...interface{}) (Payload, error)
 	CanFire(context.Context, Payload, Trigger) error
+	Explain(context.Context, Payload, Trigger) Explanation
 	EnumerateActiveTriggers(payload Payload) ([]Trigger, error)
+	EnumerateActiveTriggersContext(ctx context.Context, payload Payload, includeBlocked bool) ([]TriggerStatus, error)
+}
+
+// TriggerStatus reports whether a trigger permitted in a state can currently be fired.  Err holds the
+// reason a blocked trigger can't be fired, typically the error of its guard.
+type TriggerStatus struct {
+	Trigger Trigger
+	Enabled bool
+	Err     error
+}
+
+// Explanation describes how a state machine evaluated a trigger for a payload.  Err is the error CanFire
+// returns, nil when the trigger can be fired or is ignored.
+type Explanation struct {
+	State          State
+	Trigger        Trigger
+	StateFound     bool
+	TriggerDefined bool
+	Ignored        bool
+	// Guards holds the permits of the trigger in declaration order with the outcome of their guards.
+	Guards []GuardResult
+	Err    error
+}
+
+// GuardResult is the outcome of evaluating the guard of one permit.  Unguarded permits always pass.
+type GuardResult struct {
+	Destinations []State
+	GuardName    string
+	Passed       bool
+	Err          error
 }
 
 type TransitionInfo interface {
 	GetSource() State
 	GetDestination() State
 	GetTrigger() Trigger
+	GetArgs() []interface{}
 }
 
 type ModifiableTransitionInfo interface {
 	GetSource() State
 	GetDestination() State
 	GetTrigger() Trigger
+	GetArgs() []interface{}
 	SetDestination(State)
 }
 
 type SideEffect func(context.Context, StateAction, Payload, TransitionInfo, int64)
 
 type PlinkoDefinition interface {
+	Graph
 	Configure(State, ...StateOption) StateDefinition
 	SideEffect(SideEffect) PlinkoDefinition
 	FilteredSideEffect(SideEffectFilter, SideEffect) PlinkoDefinition
+	TriggerParameters(Trigger, ...reflect.Type) PlinkoDefinition
+	OnUnhandledTrigger(UnhandledTriggerHandler) PlinkoDefinition
+	Use(...Interceptor) PlinkoDefinition
+	InitialState(State) PlinkoDefinition
 	Compile() CompilerOutput
+	CompileStrict() (StateMachine, error)
 	RenderUml() (Uml, error)
+	RenderMermaid() (Mermaid, error)
 	Render(Renderer) error
 }
 
@@ -62,17 +120,73 @@ type Renderer interface {
 type Graph interface {
 	Edges(func(State, State, Trigger))
 	Nodes(func(State, StateConfig))
+	// Describe reports each state with its own permits and operation chains, in declaration order.
+	Describe(func(StateInfo))
 }
 
+// RenderDirection is the direction in which a diagram lays out its transitions.
+type RenderDirection string
+
+const (
+	TopToBottom RenderDirection = "TB"
+	LeftToRight RenderDirection = "LR"
+	BottomToTop RenderDirection = "BT"
+	RightToLeft RenderDirection = "RL"
+)
+
+// RenderConfig holds the options shared by the diagram renderers.
+type RenderConfig struct {
+	Title string
+	// Direction is left to the renderer's default layout when empty.
+	Direction RenderDirection
+	// Stylesheet is written verbatim into the diagram header, in the syntax of the renderer.
+	Stylesheet          string
+	IncludeDescriptions bool
+	// Highlight lists the states drawn with an accent color.
+	Highlight []State
+}
+
+type RenderOption func(c *RenderConfig)
+
 type Payload interface {
 	GetState() State
 }
 
+// MutablePayload is an optional extension of Payload.  When a payload implements it, Fire records
+// the landing state through SetState at the point selected by DefinitionConfig.StateUpdate.
+type MutablePayload interface {
+	Payload
+	SetState(State)
+}
+
 type CompilerMessage struct {
 	CompileMessage CompilerReportType
 	Message        string
+	// Code identifies the kind of problem and stays the same across releases, unlike Message.
+	Code CompilerMessageCode
 }
 
+type CompilerMessageCode string
+
+const (
+	UndefinedStateCode           CompilerMessageCode = "undefined-state"
+	MissingDestinationsCode      CompilerMessageCode = "missing-destinations"
+	SuperstateCycleCode          CompilerMessageCode = "superstate-cycle"
+	DeadEndStateCode             CompilerMessageCode = "dead-end-state"
+	ShadowedPermitCode           CompilerMessageCode = "shadowed-permit"
+	AutoTransitionCycleCode      CompilerMessageCode = "auto-transition-cycle"
+	UnusedTriggerParametersCode  CompilerMessageCode = "unused-trigger-parameters"
+	UndefinedInitialStateCode    CompilerMessageCode = "undefined-initial-state"
+	MissingInitialStateCode      CompilerMessageCode = "missing-initial-state"
+	UnreachableStateCode         CompilerMessageCode = "unreachable-state"
+	NoTerminalStateReachableCode CompilerMessageCode = "no-terminal-state-reachable"
+	UnusedTriggerCode            CompilerMessageCode = "unused-trigger"
+	InescapableComponentCode     CompilerMessageCode = "inescapable-component"
+	TerminalStateTransitionsCode CompilerMessageCode = "terminal-state-transitions"
+	InvalidDocumentCode          CompilerMessageCode = "invalid-document"
+	UnknownReferenceCode         CompilerMessageCode = "unknown-reference"
+)
+
 type CompilerReportType string
 
 const (
@@ -87,32 +201,230 @@ const (
 	BeforeTransition StateAction = "BeforeTransition"
 	BetweenStates    StateAction = "MiddleTransition"
 	AfterTransition  StateAction = "AfterTransition"
+	// InternalAction is raised once an internal transition's operation completes; the state is unchanged
+	// and no exit or entry chain has run.
+	InternalAction StateAction = "InternalTransition"
+	// TransitionCanceled is raised when a transition stops because its context was canceled or its
+	// deadline passed, after the OnError chain has run.
+	TransitionCanceled StateAction = "TransitionCanceled"
 )
 
 type SideEffectFilter int
 
 const (
-	AllowBeforeTransition SideEffectFilter = 1
-	AllowBetweenStates    SideEffectFilter = 2
-	AllowAfterTransition  SideEffectFilter = 4
+	AllowBeforeTransition   SideEffectFilter = 1
+	AllowBetweenStates      SideEffectFilter = 2
+	AllowAfterTransition    SideEffectFilter = 4
+	AllowInternalAction     SideEffectFilter = 8
+	AllowTransitionCanceled SideEffectFilter = 16
 )
 
 type Uml string
+type Mermaid string
 
 type CompilerOutput struct {
 	StateMachine StateMachine
 	Messages     []CompilerMessage
+	// Fingerprint is a stable hash over the states, triggers, destinations, guard names and operation
+	// names of the definition.  Two definitions with the same structure share a fingerprint.
+	Fingerprint string
+}
+
+// DefinitionDiff lists the structural changes between two definitions, in state and trigger order.
+type DefinitionDiff struct {
+	AddedStates        []State
+	RemovedStates      []State
+	AddedTriggers      []TriggerChange
+	RemovedTriggers    []TriggerChange
+	RetargetedTriggers []TriggerChange
+	// ChangedGuards lists the triggers whose destinations are unchanged but whose guards are not.
+	ChangedGuards     []TriggerChange
+	ChangedOperations []OperationChange
+	ChangedIgnores    []IgnoreChange
+	ChangedParameters []ParameterChange
+}
+
+// Empty reports whether the definitions have the same structure.
+func (d DefinitionDiff) Empty() bool {
+	return len(d.AddedStates) == 0 && len(d.RemovedStates) == 0 &&
+		len(d.AddedTriggers) == 0 && len(d.RemovedTriggers) == 0 && len(d.RetargetedTriggers) == 0 &&
+		len(d.ChangedGuards) == 0 && len(d.ChangedOperations) == 0 &&
+		len(d.ChangedIgnores) == 0 && len(d.ChangedParameters) == 0
+}
+
+// TriggerChange describes a trigger permitted by a state before and after the change.  The Before fields
+// are empty for added triggers and the After fields for removed ones.
+type TriggerChange struct {
+	State        State
+	Trigger      Trigger
+	Before       []State
+	After        []State
+	GuardsBefore []string
+	GuardsAfter  []string
+}
+
+// OperationChange describes an entry, exit or error chain whose operation names changed.  An operation
+// limited to a trigger by OnTriggerEntry or OnTriggerExit is listed as "Name [Trigger]".  For the
+// operation of an internal transition, Kind is InternalTransitionOperation and Trigger is set.
+type OperationChange struct {
+	State   State
+	Kind    OperationKind
+	Trigger Trigger
+	Before  []string
+	After   []string
+}
+
+// IgnoreChange describes a state whose ignored triggers changed.
+type IgnoreChange struct {
+	State  State
+	Before []Trigger
+	After  []Trigger
+}
+
+// ParameterChange describes a trigger whose declared parameter types changed.
+type ParameterChange struct {
+	Trigger Trigger
+	Before  []string
+	After   []string
 }
 
 type OperationConfig struct {
 	Name string
+	// Trigger limits an entry or exit operation to the transitions fired by that trigger, it's set by
+	// OnTriggerEntry and OnTriggerExit.  Empty means the operation runs on every transition.
+	Trigger Trigger
+	// Timeout bounds each attempt of the operation, zero means no limit.  A timed-out attempt is abandoned
+	// rather than waited for: it keeps running on its own goroutine with a canceled context, and what it
+	// returns is discarded, so it must not change the payload once its context is done.
+	Timeout time.Duration
+	// Retry re-runs a failing operation, nil means the operation runs once.
+	Retry *RetryPolicy
+	// Compensation undoes the operation when a later step of the same transition fails.
+	Compensation Operation
+}
+
+// Backoff returns how long to wait before the given retry attempt, starting with attempt 2.
+type Backoff func(attempt int) time.Duration
+
+// RetryPolicy describes how often an operation is attempted and which errors are worth another attempt.
+// A nil Backoff retries immediately and a nil Retryable retries every error.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     Backoff
+	Retryable   func(error) bool
 }
 
 type OperationOption func(c *OperationConfig)
 
+// OperationKind identifies the chain an intercepted operation belongs to.
+type OperationKind string
+
+const (
+	OnEntryOperation            OperationKind = "OnEntry"
+	OnExitOperation             OperationKind = "OnExit"
+	OnErrorOperation            OperationKind = "OnError"
+	InternalTransitionOperation OperationKind = "InternalTransition"
+)
+
+// OperationInfo describes the chain step an Interceptor is wrapping.
+type OperationInfo struct {
+	State  State
+	Kind   OperationKind
+	Step   int
+	Config OperationConfig
+	// Err is the error being handled, set for OnError operations only.
+	Err error
+}
+
+// Interceptor wraps every step of the entry, exit, error and internal transition chains.  It returns the
+// operation to run in place of next, and is expected to call next to continue the chain.
+type Interceptor func(next Operation, info OperationInfo) Operation
+
 type StateConfig struct {
 	Name        string
 	Description string
+	// Parent is the superstate declared with SubstateOf, empty for top-level states.
+	Parent State
+	// Initial is set on the state declared with InitialState.
+	Initial bool
+	// Terminal is set on states declared with Terminal, which are intended to end the machine.
+	Terminal bool
+	// SuppressedRules lists the lint rules that are not run for the state.
+	SuppressedRules []CompilerMessageCode
 }
 
 type StateOption func(c *StateConfig)
+
+// StateUpdatePoint selects when Fire writes the landing state back to a MutablePayload.
+type StateUpdatePoint int
+
+const (
+	// UpdateStateAfterEntry writes the state once the destination's entry chain has succeeded.
+	UpdateStateAfterEntry StateUpdatePoint = iota
+	// UpdateStateBeforeEntry writes the state between the exit and entry chains.
+	UpdateStateBeforeEntry
+)
+
+// DefaultMaxAutoTransitions is the number of automatic transitions a single Fire follows unless
+// DefinitionConfig.MaxAutoTransitions says otherwise.
+const DefaultMaxAutoTransitions = 10
+
+type DefinitionConfig struct {
+	StateUpdate        StateUpdatePoint
+	MaxAutoTransitions int
+	// WarningsAsErrors reports every compile warning as a compile error.
+	WarningsAsErrors bool
+	LintRules        []LintRule
+}
+
+// LintRule checks a configured state against a house rule.  Compile runs each rule over every state that
+// doesn't suppress it and reports the messages it returns with the rule's ID as their Code.
+type LintRule interface {
+	ID() CompilerMessageCode
+	Check(StateInfo) []CompilerMessage
+}
+
+// StateInfo is the read-only view of a configured state handed to lint rules and renderers.
+type StateInfo struct {
+	State  State
+	Config StateConfig
+	// Permits lists the transitions the state declares itself, in declaration order.
+	Permits         []PermitInfo
+	Ignored         []Trigger
+	EntryOperations []OperationConfig
+	ExitOperations  []OperationConfig
+	ErrorOperations []OperationConfig
+	// InheritedErrorOperations lists the OnError operations of the state's superstates, innermost first,
+	// which run after its own when a transition into or out of it fails.
+	InheritedErrorOperations []OperationConfig
+}
+
+// PermitInfo describes a transition declared by a state.
+type PermitInfo struct {
+	Trigger Trigger
+	// Destinations lists the states the permit can transition to.  It is empty for an internal transition,
+	// which stays in its state without leaving it.
+	Destinations []State
+	Guarded      bool
+	GuardName    string
+	Reentry      bool
+	Dynamic      bool
+	// SelectorName names the destination selector of a dynamic permit.
+	SelectorName string
+	Internal     bool
+	Automatic    bool
+	// Operation describes the operation of an internal transition.
+	Operation OperationConfig
+}
+
+// Registry resolves the operation, guard and destination selector names used by definitions loaded from
+// documents.
+type Registry struct {
+	Operations      map[string]Operation
+	Predicates      map[string]Predicate
+	ErrorOperations map[string]ErrorOperation
+	SideEffects     map[string]SideEffect
+	Selectors       map[string]DestinationSelector
+}
+
+type DefinitionOption func(c *DefinitionConfig)
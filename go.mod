@@ -6,4 +6,5 @@ require (
 	github.com/bmizerany/assert v0.0.0-20160611221934-b7ed37b82869
 	github.com/kr/pretty v0.2.1 // indirect
 	github.com/stretchr/testify v1.6.1
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -9,7 +9,10 @@ package composition
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"runtime/debug"
+	"time"
 
 	"github.com/shipt/plinko"
 	"github.com/shipt/plinko/internal/sideeffects"
@@ -34,6 +37,42 @@ type CallbackDefinitions struct {
 
 	EntryFunctionChain []string
 	ExitFunctionChain  []string
+
+	// State and Interceptors describe the steps to the interceptors registered with Use.  Interceptors is
+	// shared with the definition so interceptors registered after the state is configured still apply.
+	State        plinko.State
+	Interceptors *[]plinko.Interceptor
+}
+
+// interceptor applies the registered interceptors to the steps of one chain.
+type interceptor struct {
+	list  []plinko.Interceptor
+	state plinko.State
+	kind  plinko.OperationKind
+}
+
+func (cd *CallbackDefinitions) interceptor(kind plinko.OperationKind) interceptor {
+	ic := interceptor{state: cd.State, kind: kind}
+	if cd.Interceptors != nil {
+		ic.list = *cd.Interceptors
+	}
+
+	return ic
+}
+
+// wrap returns op wrapped by the interceptors, the first one registered being the outermost.
+func (ic interceptor) wrap(op plinko.Operation, step int, cfg plinko.OperationConfig, err error) plinko.Operation {
+	for i := len(ic.list) - 1; i >= 0; i-- {
+		op = ic.list[i](op, plinko.OperationInfo{
+			State:  ic.state,
+			Kind:   ic.kind,
+			Step:   step,
+			Config: cfg,
+			Err:    err,
+		})
+	}
+
+	return op
 }
 
 func (cd *CallbackDefinitions) AddError(errorOperation plinko.ErrorOperation, cfg plinko.OperationConfig) *CallbackDefinitions {
@@ -68,7 +107,53 @@ func (cd *CallbackDefinitions) AddExit(predicate plinko.Predicate, operation pli
 	return cd
 }
 
-func executeChain(ctx context.Context, funcs []ChainedFunctionCall, p plinko.Payload, t plinko.TransitionInfo) (retPayload plinko.Payload, err error) {
+func executeChain(ctx context.Context, funcs []ChainedFunctionCall, p plinko.Payload, t plinko.TransitionInfo, ic interceptor) (plinko.Payload, error) {
+	var journal Journal
+	p, err := runChain(ctx, funcs, p, t, ic, &journal.completed)
+	if err != nil {
+		return journal.Compensate(ctx, p, t, err)
+	}
+
+	return p, err
+}
+
+// completedStep records a step that ran successfully so it can be compensated if a later step fails.
+type completedStep struct {
+	ChainedFunctionCall
+	step int
+}
+
+// Journal records the steps that completed across the chains of a transition, so a failure in any of
+// them undoes the steps of the chains that ran before it as well.
+type Journal struct {
+	completed []completedStep
+}
+
+// Compensate undoes the recorded steps in reverse order and returns err, or a PlinkoCompensationError
+// wrapping it when a compensation failed.
+func (j *Journal) Compensate(ctx context.Context, p plinko.Payload, t plinko.TransitionInfo, err error) (plinko.Payload, error) {
+	return j.CompensateFrom(ctx, p, t, err, 0)
+}
+
+// Len returns the number of steps recorded so far, marking where the steps of the next chain start.
+func (j *Journal) Len() int {
+	return len(j.completed)
+}
+
+// CompensateFrom undoes the steps recorded from mark on, like Compensate, and forgets them.  The steps
+// recorded before mark are kept.
+func (j *Journal) CompensateFrom(ctx context.Context, p plinko.Payload, t plinko.TransitionInfo, err error, mark int) (plinko.Payload, error) {
+	if len(j.completed) <= mark {
+		return p, err
+	}
+
+	steps := j.completed[mark:]
+	j.completed = j.completed[:mark]
+
+	return compensate(ctx, steps, p, t, err)
+}
+
+func runChain(ctx context.Context, funcs []ChainedFunctionCall, p plinko.Payload, t plinko.TransitionInfo, ic interceptor, completed *[]completedStep) (retPayload plinko.Payload, err error) {
 	var stepName string
 	step := 0
 	defer func() {
@@ -82,18 +167,28 @@ func executeChain(ctx context.Context, funcs []ChainedFunctionCall, p plinko.Pay
 	if len(funcs) > 0 {
 		for _, fn := range funcs {
 			stepName = fn.Config.Name
+
+			// stop between steps once the caller has given up on the transition
+			if e := ctx.Err(); e != nil {
+				return p, plinkoerror.CreatePlinkoContextError(e, t, step, stepName)
+			}
+
 			if fn.Predicate != nil {
 				if err = fn.Predicate(ctx, p, t); err != nil {
 					// in this case, the predicate failed meaning the function should not be executed.
 					continue
 				}
 			}
+			original := fn
+			fn.Operation = ic.wrap(fn.Operation, step, fn.Config, nil)
+
 			var e error
-			p, e = fn.Operation(ctx, p, t)
-			step++
+			p, e = runOperation(ctx, fn, p, t, step)
 			if e != nil {
 				return p, e
 			}
+			*completed = append(*completed, completedStep{original, step})
+			step++
 		}
 	}
 
@@ -101,7 +196,168 @@ func executeChain(ctx context.Context, funcs []ChainedFunctionCall, p plinko.Pay
 
 }
 
-func executeErrorChain(ctx context.Context, funcs []ChainedErrorCall, p plinko.Payload, t *sideeffects.TransitionDef, err error) (retPayload plinko.Payload, retTd *sideeffects.TransitionDef, retErr error) {
+// compensate undoes the completed steps in reverse order.  Compensations run even when the transition
+// was canceled, so they are given a context that keeps the caller's values but not its cancellation.
+// A failing compensation doesn't stop the others; the failures are reported alongside the original error.
+func compensate(ctx context.Context, completed []completedStep, p plinko.Payload, t plinko.TransitionInfo, err error) (plinko.Payload, error) {
+	ctx = detachedContext{ctx}
+
+	var failures []plinkoerror.CompensationFailure
+	for i := len(completed) - 1; i >= 0; i-- {
+		cs := completed[i]
+		if cs.Config.Compensation == nil {
+			continue
+		}
+
+		var e error
+		p, e = runCompensation(ctx, cs, p, t)
+		if e != nil {
+			failures = append(failures, plinkoerror.CompensationFailure{
+				StepNumber: cs.step,
+				StepName:   cs.Config.Name,
+				Err:        e,
+			})
+		}
+	}
+
+	if len(failures) > 0 {
+		return p, plinkoerror.CreatePlinkoCompensationError(err, t, failures)
+	}
+
+	return p, err
+}
+
+func runCompensation(ctx context.Context, cs completedStep, p plinko.Payload, t plinko.TransitionInfo) (retPayload plinko.Payload, err error) {
+	defer func() {
+		if err1 := recover(); err1 != nil {
+			stack := string(debug.Stack())
+			retPayload = p
+			err = plinkoerror.CreatePlinkoPanicError(err1, t, cs.step, cs.Config.Name, stack)
+		}
+	}()
+
+	retPayload, err = cs.Config.Compensation(ctx, p, t)
+	if retPayload == nil {
+		// keep the payload we have rather than losing it to a failed compensation
+		retPayload = p
+	}
+
+	return retPayload, err
+}
+
+// detachedContext carries the values of its parent but is never canceled.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// runOperation executes a step, attempting it again as long as its retry policy allows.  Every attempt
+// starts from the payload the step was given.
+func runOperation(ctx context.Context, fn ChainedFunctionCall, p plinko.Payload, t plinko.TransitionInfo, step int) (plinko.Payload, error) {
+	policy := fn.Config.Retry
+	if policy == nil {
+		return attemptOperation(ctx, fn, p, t, step)
+	}
+
+	attempts := 0
+	for {
+		attempts++
+		retPayload, err := attemptOperation(ctx, fn, p, t, step)
+		if err == nil {
+			return retPayload, nil
+		}
+
+		if attempts >= policy.MaxAttempts || !isRetryable(policy, err) {
+			if attempts == 1 {
+				return retPayload, err
+			}
+			return retPayload, plinkoerror.CreatePlinkoRetryError(err, t, step, fn.Config.Name, attempts, policy.MaxAttempts)
+		}
+
+		var wait time.Duration
+		if policy.Backoff != nil {
+			wait = policy.Backoff(attempts + 1)
+		}
+		if e := sleep(ctx, wait); e != nil {
+			return p, plinkoerror.CreatePlinkoContextError(e, t, step, fn.Config.Name)
+		}
+	}
+}
+
+func isRetryable(policy *plinko.RetryPolicy, err error) bool {
+	// panics and a canceled transition are never worth another attempt
+	var pe *plinkoerror.PlinkoPanicError
+	var ce *plinkoerror.PlinkoContextError
+	if errors.As(err, &pe) || errors.As(err, &ce) {
+		return false
+	}
+
+	return policy.Retryable == nil || policy.Retryable(err)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// attemptOperation runs the operation once.  When the step has a timeout, the operation runs on its own
+// goroutine so the chain can move on when the time is up, even if the operation ignores its context.  The
+// abandoned attempt's context is canceled and whatever it returns later is discarded.
+func attemptOperation(ctx context.Context, fn ChainedFunctionCall, p plinko.Payload, t plinko.TransitionInfo, step int) (plinko.Payload, error) {
+	if fn.Config.Timeout <= 0 {
+		return fn.Operation(ctx, p, t)
+	}
+
+	stepCtx, cancel := context.WithTimeout(ctx, fn.Config.Timeout)
+	defer cancel()
+
+	type result struct {
+		payload plinko.Payload
+		err     error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			// a panic on this goroutine can't reach the recover in executeChain
+			if err1 := recover(); err1 != nil {
+				done <- result{p, plinkoerror.CreatePlinkoPanicError(err1, t, step, fn.Config.Name, string(debug.Stack()))}
+			}
+		}()
+
+		retPayload, err := fn.Operation(stepCtx, p, t)
+		done <- result{retPayload, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.payload, r.err
+	case <-stepCtx.Done():
+		if e := ctx.Err(); e != nil {
+			return p, plinkoerror.CreatePlinkoContextError(e, t, step, fn.Config.Name)
+		}
+		return p, fmt.Errorf("step %d (%s) timed out after %s: %w", step, fn.Config.Name, fn.Config.Timeout, context.DeadlineExceeded)
+	}
+}
+
+func executeErrorChain(ctx context.Context, funcs []ChainedErrorCall, p plinko.Payload, t *sideeffects.TransitionDef, err error, ic interceptor) (retPayload plinko.Payload, retTd *sideeffects.TransitionDef, retErr error) {
 	var stepName string
 	step := 0
 	defer func() {
@@ -114,10 +370,17 @@ func executeErrorChain(ctx context.Context, funcs []ChainedErrorCall, p plinko.P
 	}()
 
 	if len(funcs) > 0 {
-		for _, fn := range funcs {
+		for i, fn := range funcs {
+			step = i
 			stepName = fn.Config.Name
+
+			errorOperation := fn.ErrorOperation
+			op := ic.wrap(func(ctx context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+				return errorOperation(ctx, p, t, err)
+			}, step, fn.Config, err)
+
 			var e error
-			p, e = fn.ErrorOperation(ctx, p, t, err)
+			p, e = op(ctx, p, t)
 
 			if e != nil {
 				return p, t, e
@@ -128,16 +391,34 @@ func executeErrorChain(ctx context.Context, funcs []ChainedErrorCall, p plinko.P
 	return p, t, err
 }
 
+// ExecuteInternalChain runs the operations of an internal transition declared on the state, which aren't
+// part of its entry or exit chains.
+func (cd *CallbackDefinitions) ExecuteInternalChain(ctx context.Context, funcs []ChainedFunctionCall, p plinko.Payload, t plinko.TransitionInfo) (plinko.Payload, error) {
+	return executeChain(ctx, funcs, p, t, cd.interceptor(plinko.InternalTransitionOperation))
+}
+
 func (cd *CallbackDefinitions) ExecuteExitChain(ctx context.Context, p plinko.Payload, t plinko.TransitionInfo) (plinko.Payload, error) {
-	return executeChain(ctx, cd.OnExitFn, p, t)
+	return executeChain(ctx, cd.OnExitFn, p, t, cd.interceptor(plinko.OnExitOperation))
 }
 
 func (cd *CallbackDefinitions) ExecuteEntryChain(ctx context.Context, p plinko.Payload, t plinko.TransitionInfo) (plinko.Payload, error) {
-	return executeChain(ctx, cd.OnEntryFn, p, t)
+	return executeChain(ctx, cd.OnEntryFn, p, t, cd.interceptor(plinko.OnEntryOperation))
+}
+
+// RunExitChain runs the exit chain, recording the steps that complete in the journal.  Unlike
+// ExecuteExitChain it doesn't compensate them when a step fails; that is left to the journal's owner.
+func (cd *CallbackDefinitions) RunExitChain(ctx context.Context, p plinko.Payload, t plinko.TransitionInfo, journal *Journal) (plinko.Payload, error) {
+	return runChain(ctx, cd.OnExitFn, p, t, cd.interceptor(plinko.OnExitOperation), &journal.completed)
+}
+
+// RunEntryChain runs the entry chain, recording the steps that complete in the journal.  Unlike
+// ExecuteEntryChain it doesn't compensate them when a step fails; that is left to the journal's owner.
+func (cd *CallbackDefinitions) RunEntryChain(ctx context.Context, p plinko.Payload, t plinko.TransitionInfo, journal *Journal) (plinko.Payload, error) {
+	return runChain(ctx, cd.OnEntryFn, p, t, cd.interceptor(plinko.OnEntryOperation), &journal.completed)
 }
 
 func (cd *CallbackDefinitions) ExecuteErrorChain(ctx context.Context, p plinko.Payload, t *sideeffects.TransitionDef, err error, elapsedMilliseconds int64) (plinko.Payload, *sideeffects.TransitionDef, error) {
-	p, mt, err := executeErrorChain(ctx, cd.OnErrorFn, p, t, err)
+	p, mt, err := executeErrorChain(ctx, cd.OnErrorFn, p, t, err, cd.interceptor(plinko.OnErrorOperation))
 
 	return p, mt, err
 }
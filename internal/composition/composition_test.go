@@ -10,7 +10,9 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/shipt/plinko"
 	"github.com/shipt/plinko/internal/sideeffects"
@@ -90,7 +92,7 @@ func TestExecuteErrorChainSingleFunctionWithModifiedDestination(t *testing.T) {
 		},
 	}
 
-	p, t1, e := executeErrorChain(context.TODO(), list, nil, &transitionDef, errors.New("wizard"))
+	p, t1, e := executeErrorChain(context.TODO(), list, nil, &transitionDef, errors.New("wizard"), interceptor{})
 
 	assert.Equal(t, ErrorState, t1.GetDestination())
 	assert.Equal(t, errors.New("wizard"), e)
@@ -123,7 +125,7 @@ func TestExecuteErrorChainMultiFunctionWithError(t *testing.T) {
 		},
 	}
 
-	p, t1, e := executeErrorChain(context.TODO(), list, nil, &transitionDef, errors.New("wizard"))
+	p, t1, e := executeErrorChain(context.TODO(), list, nil, &transitionDef, errors.New("wizard"), interceptor{})
 
 	assert.Equal(t, GoodState, t1.GetDestination())
 	assert.Equal(t, 1, counter)
@@ -157,7 +159,7 @@ func TestChainedFunctionWithError(t *testing.T) {
 		},
 	}
 
-	p, err := executeChain(context.TODO(), list, payload, transitionDef)
+	p, err := executeChain(context.TODO(), list, payload, transitionDef, interceptor{})
 
 	assert.NotNil(t, p)
 	assert.NotNil(t, err)
@@ -193,7 +195,7 @@ func TestChainedFunctionWithFailedPredicate(t *testing.T) {
 		},
 	}
 
-	p, err := executeChain(context.TODO(), list, payload, transitionDef)
+	p, err := executeChain(context.TODO(), list, payload, transitionDef, interceptor{})
 	p1 := p.(testPayload)
 
 	assert.NotNil(t, p1)
@@ -239,7 +241,7 @@ func TestChainedFunctionPassingProperly(t *testing.T) {
 		},
 	}
 
-	p, err := executeChain(context.TODO(), list, payload, transitionDef)
+	p, err := executeChain(context.TODO(), list, payload, transitionDef, interceptor{})
 
 	assert.NotNil(t, p)
 	assert.Nil(t, err)
@@ -268,7 +270,7 @@ func TestChainedFunctionChainWithPanic(t *testing.T) {
 		},
 	}
 
-	p, err := executeChain(context.TODO(), list, nil, transitionDef)
+	p, err := executeChain(context.TODO(), list, nil, transitionDef, interceptor{})
 
 	assert.Nil(t, p)
 	assert.NotNil(t, err)
@@ -305,7 +307,7 @@ func TestErrorFunctionChainWithPanic(t *testing.T) {
 		},
 	}
 
-	p, td2, err := executeErrorChain(context.TODO(), list, nil, &transitionDef, errors.New("encompassing-error"))
+	p, td2, err := executeErrorChain(context.TODO(), list, nil, &transitionDef, errors.New("encompassing-error"), interceptor{})
 
 	assert.Nil(t, p)
 	assert.NotNil(t, err)
@@ -363,3 +365,348 @@ func TestExecuteExitChain(t *testing.T) {
 
 	assert.Equal(t, "foo", p1.value)
 }
+
+func TestChainedFunctionStopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	counter := 0
+
+	list := []ChainedFunctionCall{
+		{
+			Operation: func(_ context.Context, p plinko.Payload, m plinko.TransitionInfo) (plinko.Payload, error) {
+				counter++
+				cancel()
+				return p, nil
+			},
+			Config: plinko.OperationConfig{Name: "first"},
+		},
+		{
+			Operation: func(_ context.Context, p plinko.Payload, m plinko.TransitionInfo) (plinko.Payload, error) {
+				counter++
+				return p, nil
+			},
+			Config: plinko.OperationConfig{Name: "second"},
+		},
+	}
+
+	_, err := executeChain(ctx, list, testPayload{}, sideeffects.TransitionDef{}, interceptor{})
+
+	assert.Equal(t, 1, counter)
+
+	var pce *plinkoerror.PlinkoContextError
+	assert.True(t, errors.As(err, &pce))
+	assert.Equal(t, 1, pce.StepNumber)
+	assert.Equal(t, "second", pce.StepName)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+var errUnavailable = errors.New("unavailable")
+
+func failingOperation(counter *int, failures int) plinko.Operation {
+	return func(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+		*counter++
+		if *counter <= failures {
+			return p, errUnavailable
+		}
+		return testPayload{value: "done"}, nil
+	}
+}
+
+func TestChainedFunctionRetriesUntilSuccess(t *testing.T) {
+	counter := 0
+	list := []ChainedFunctionCall{{
+		Operation: failingOperation(&counter, 2),
+		Config:    plinko.OperationConfig{Name: "reserve", Retry: &plinko.RetryPolicy{MaxAttempts: 3}},
+	}}
+
+	p, err := executeChain(context.Background(), list, testPayload{}, sideeffects.TransitionDef{}, interceptor{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, counter)
+	assert.Equal(t, "done", p.(testPayload).value)
+}
+
+func TestChainedFunctionRetriesExhausted(t *testing.T) {
+	counter := 0
+	var waits []int
+	list := []ChainedFunctionCall{{
+		Operation: failingOperation(&counter, 5),
+		Config: plinko.OperationConfig{Name: "reserve", Retry: &plinko.RetryPolicy{
+			MaxAttempts: 3,
+			Backoff: func(attempt int) time.Duration {
+				waits = append(waits, attempt)
+				return time.Millisecond
+			},
+		}},
+	}}
+
+	_, err := executeChain(context.Background(), list, testPayload{}, sideeffects.TransitionDef{}, interceptor{})
+
+	var re *plinkoerror.PlinkoRetryError
+	if assert.True(t, errors.As(err, &re)) {
+		assert.Equal(t, 3, re.Attempts)
+		assert.True(t, re.Exhausted())
+		assert.Equal(t, "reserve", re.StepName)
+	}
+	assert.True(t, errors.Is(err, errUnavailable))
+	assert.Equal(t, 3, counter)
+	assert.Equal(t, []int{2, 3}, waits)
+}
+
+func TestChainedFunctionRetryStopsOnUnretryableError(t *testing.T) {
+	counter := 0
+	list := []ChainedFunctionCall{{
+		Operation: failingOperation(&counter, 5),
+		Config: plinko.OperationConfig{Retry: &plinko.RetryPolicy{
+			MaxAttempts: 3,
+			Retryable:   func(error) bool { return false },
+		}},
+	}}
+
+	_, err := executeChain(context.Background(), list, testPayload{}, sideeffects.TransitionDef{}, interceptor{})
+
+	// a failure on the first attempt is reported as is
+	var re *plinkoerror.PlinkoRetryError
+	assert.False(t, errors.As(err, &re))
+	assert.Equal(t, errUnavailable, err)
+	assert.Equal(t, 1, counter)
+}
+
+func TestChainedFunctionTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	counter := 0
+	list := []ChainedFunctionCall{
+		{
+			Operation: func(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+				// ignores its context on purpose
+				<-release
+				return p, nil
+			},
+			Config: plinko.OperationConfig{Name: "slow", Timeout: 10 * time.Millisecond},
+		},
+		{
+			Operation: failingOperation(&counter, 0),
+		},
+	}
+
+	_, err := executeChain(context.Background(), list, testPayload{}, sideeffects.TransitionDef{}, interceptor{})
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, strings.Contains(err.Error(), "slow"))
+	assert.Equal(t, 0, counter)
+}
+
+func TestChainedFunctionTimeoutWithRetry(t *testing.T) {
+	var counter int32
+	list := []ChainedFunctionCall{{
+		Operation: func(ctx context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+			// attempts run on their own goroutines
+			if atomic.AddInt32(&counter, 1) == 1 {
+				<-ctx.Done()
+				return p, ctx.Err()
+			}
+			return p, nil
+		},
+		Config: plinko.OperationConfig{Timeout: 10 * time.Millisecond, Retry: &plinko.RetryPolicy{MaxAttempts: 2}},
+	}}
+
+	_, err := executeChain(context.Background(), list, testPayload{}, sideeffects.TransitionDef{}, interceptor{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&counter))
+}
+
+func TestChainedFunctionTimeoutWithPanic(t *testing.T) {
+	list := []ChainedFunctionCall{{
+		Operation: func(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+			panic("operation panicked")
+		},
+		Config: plinko.OperationConfig{Name: "panics", Timeout: time.Second, Retry: &plinko.RetryPolicy{MaxAttempts: 3}},
+	}}
+
+	_, err := executeChain(context.Background(), list, testPayload{}, sideeffects.TransitionDef{}, interceptor{})
+
+	var pe *plinkoerror.PlinkoPanicError
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, "panics", pe.StepName)
+}
+
+func recordingOperation(steps *[]string, name string, err error) plinko.Operation {
+	return func(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+		*steps = append(*steps, name)
+		return p, err
+	}
+}
+
+func TestChainedFunctionCompensation(t *testing.T) {
+	var steps []string
+	stepErr := errors.New("card declined")
+
+	list := []ChainedFunctionCall{
+		{
+			Operation: recordingOperation(&steps, "reserve", nil),
+			Config:    plinko.OperationConfig{Name: "reserve", Compensation: recordingOperation(&steps, "release", nil)},
+		},
+		{
+			Predicate: func(context.Context, plinko.Payload, plinko.TransitionInfo) error { return errors.New("skip") },
+			Operation: recordingOperation(&steps, "skipped", nil),
+			Config:    plinko.OperationConfig{Compensation: recordingOperation(&steps, "undo skipped", nil)},
+		},
+		{
+			Operation: recordingOperation(&steps, "notify", nil),
+		},
+		{
+			Operation: recordingOperation(&steps, "hold", nil),
+			Config:    plinko.OperationConfig{Name: "hold", Compensation: recordingOperation(&steps, "unhold", nil)},
+		},
+		{
+			Operation: recordingOperation(&steps, "charge", stepErr),
+			Config:    plinko.OperationConfig{Compensation: recordingOperation(&steps, "refund", nil)},
+		},
+	}
+
+	_, err := executeChain(context.Background(), list, testPayload{}, sideeffects.TransitionDef{}, interceptor{})
+
+	assert.Equal(t, stepErr, err)
+	assert.Equal(t, []string{"reserve", "notify", "hold", "charge", "unhold", "release"}, steps)
+}
+
+func TestChainedFunctionCompensationFailures(t *testing.T) {
+	var steps []string
+	stepErr := errors.New("card declined")
+	undoErr := errors.New("release failed")
+
+	list := []ChainedFunctionCall{
+		{
+			Operation: recordingOperation(&steps, "reserve", nil),
+			Config:    plinko.OperationConfig{Name: "reserve", Compensation: recordingOperation(&steps, "release", undoErr)},
+		},
+		{
+			Operation: recordingOperation(&steps, "hold", nil),
+			Config: plinko.OperationConfig{Name: "hold", Compensation: func(context.Context, plinko.Payload, plinko.TransitionInfo) (plinko.Payload, error) {
+				panic("unhold panicked")
+			}},
+		},
+		{
+			Operation: func(context.Context, plinko.Payload, plinko.TransitionInfo) (plinko.Payload, error) {
+				panic(stepErr)
+			},
+			Config: plinko.OperationConfig{Name: "charge"},
+		},
+	}
+
+	p, err := executeChain(context.Background(), list, testPayload{value: "order"}, sideeffects.TransitionDef{}, interceptor{})
+
+	assert.Equal(t, "order", p.(testPayload).value)
+	assert.Equal(t, []string{"reserve", "hold", "release"}, steps)
+
+	var ce *plinkoerror.PlinkoCompensationError
+	if assert.True(t, errors.As(err, &ce)) {
+		if assert.Len(t, ce.Failures, 2) {
+			assert.Equal(t, "hold", ce.Failures[0].StepName)
+			var pe *plinkoerror.PlinkoPanicError
+			assert.True(t, errors.As(ce.Failures[0].Err, &pe))
+
+			assert.Equal(t, 0, ce.Failures[1].StepNumber)
+			assert.Equal(t, undoErr, ce.Failures[1].Err)
+		}
+	}
+
+	// the failure that started the compensation is still reachable
+	var pe *plinkoerror.PlinkoPanicError
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, "charge", pe.StepName)
+}
+
+func TestChainedFunctionCompensationAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	compensationErr := errors.New("compensation not run")
+
+	list := []ChainedFunctionCall{
+		{
+			Operation: func(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+				cancel()
+				return p, nil
+			},
+			Config: plinko.OperationConfig{Compensation: func(ctx context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+				compensationErr = ctx.Err()
+				return p, nil
+			}},
+		},
+		{
+			Operation: func(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+				return p, nil
+			},
+		},
+	}
+
+	_, err := executeChain(ctx, list, testPayload{}, sideeffects.TransitionDef{}, interceptor{})
+
+	var pce *plinkoerror.PlinkoContextError
+	assert.True(t, errors.As(err, &pce))
+	assert.Nil(t, compensationErr)
+}
+
+func TestChainedFunctionInterceptors(t *testing.T) {
+	var steps []string
+	var infos []plinko.OperationInfo
+
+	tracing := func(next plinko.Operation, info plinko.OperationInfo) plinko.Operation {
+		return func(ctx context.Context, p plinko.Payload, ti plinko.TransitionInfo) (plinko.Payload, error) {
+			infos = append(infos, info)
+			steps = append(steps, "trace "+info.Config.Name)
+			return next(ctx, p, ti)
+		}
+	}
+	logging := func(next plinko.Operation, info plinko.OperationInfo) plinko.Operation {
+		return func(ctx context.Context, p plinko.Payload, ti plinko.TransitionInfo) (plinko.Payload, error) {
+			p, err := next(ctx, p, ti)
+			steps = append(steps, "log "+info.Config.Name)
+			return p, err
+		}
+	}
+
+	cd := CallbackDefinitions{
+		State:        "Opened",
+		Interceptors: &[]plinko.Interceptor{tracing, logging},
+	}
+	cd.AddEntry(nil, recordingOperation(&steps, "reserve", nil), plinko.OperationConfig{Name: "reserve"})
+	cd.AddEntry(nil, recordingOperation(&steps, "charge", nil), plinko.OperationConfig{Name: "charge"})
+
+	_, err := cd.ExecuteEntryChain(context.Background(), testPayload{}, sideeffects.TransitionDef{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"trace reserve", "reserve", "log reserve", "trace charge", "charge", "log charge"}, steps)
+	assert.Equal(t, []plinko.OperationInfo{
+		{State: "Opened", Kind: plinko.OnEntryOperation, Step: 0, Config: plinko.OperationConfig{Name: "reserve"}},
+		{State: "Opened", Kind: plinko.OnEntryOperation, Step: 1, Config: plinko.OperationConfig{Name: "charge"}},
+	}, infos)
+}
+
+func TestErrorChainInterceptors(t *testing.T) {
+	var infos []plinko.OperationInfo
+	chainErr := errors.New("card declined")
+
+	cd := CallbackDefinitions{
+		State: "Opened",
+		Interceptors: &[]plinko.Interceptor{func(next plinko.Operation, info plinko.OperationInfo) plinko.Operation {
+			infos = append(infos, info)
+			return next
+		}},
+	}
+	cd.AddError(func(_ context.Context, p plinko.Payload, m plinko.ModifiableTransitionInfo, e error) (plinko.Payload, error) {
+		m.SetDestination("Triage")
+		return p, nil
+	}, plinko.OperationConfig{Name: "redirect"})
+
+	transitionDef := sideeffects.TransitionDef{Destination: "Claimed"}
+	_, td, err := cd.ExecuteErrorChain(context.Background(), testPayload{}, &transitionDef, chainErr, 0)
+
+	assert.Equal(t, chainErr, err)
+	assert.Equal(t, plinko.State("Triage"), td.GetDestination())
+	if assert.Len(t, infos, 1) {
+		assert.Equal(t, plinko.OnErrorOperation, infos[0].Kind)
+		assert.Equal(t, chainErr, infos[0].Err)
+	}
+}
@@ -0,0 +1,33 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package renderers
+
+import (
+	"github.com/shipt/plinko"
+)
+
+func newRenderConfig(opts ...plinko.RenderOption) plinko.RenderConfig {
+	c := plinko.RenderConfig{
+		IncludeDescriptions: true,
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return c
+}
+
+func highlighted(c plinko.RenderConfig, state plinko.State) bool {
+	for _, s := range c.Highlight {
+		if s == state {
+			return true
+		}
+	}
+
+	return false
+}
@@ -8,30 +8,51 @@
 package renderers
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os/exec"
+	"strings"
 
 	"github.com/shipt/plinko"
 )
 
 type Dot struct {
 	*writeWrapper
-	style dotStylesheet
+	style  dotStylesheet
+	config plinko.RenderConfig
 }
 
-func NewDot(w io.Writer) *Dot {
+func NewDot(w io.Writer, opts ...plinko.RenderOption) *Dot {
 	return &Dot{
 		writeWrapper: &writeWrapper{writer: w},
 		style:        defaultDotStyle,
+		config:       newRenderConfig(opts...),
 	}
 }
 
 func (d *Dot) Render(graph plinko.Graph) error {
 	d.beginGraph()
 	graph.Nodes(func(state plinko.State, info plinko.StateConfig) {
-		d.node(string(state), info.Name, info.Description)
+		d.node(state, info.Name, info.Description)
 	})
+	newStateTree(graph).walk(func(state plinko.State, _ int) {
+		d.beginCluster(string(state))
+	}, func(state plinko.State, _ int) {
+		d.clusterMember(string(state))
+	}, func(state plinko.State, _ int) {
+		d.endCluster()
+	})
+
+	initial, terminals := markers(graph)
+	if initial != "" {
+		d.write([]byte(fmt.Sprintf(d.style.templates.initial, initial)))
+	}
+	for _, state := range terminals {
+		d.write([]byte(fmt.Sprintf(d.style.templates.terminal, state, state, state)))
+	}
+
 	graph.Edges(func(state, destinationState plinko.State, name plinko.Trigger) {
 		d.edge(string(state), string(destinationState), string(name))
 	})
@@ -41,36 +62,100 @@ func (d *Dot) Render(graph plinko.Graph) error {
 
 func (d *Dot) beginGraph() {
 	d.write([]byte("digraph {\n"))
-	d.write([]byte(d.style.graphHeader))
+	if d.config.Direction != "" {
+		// fdp ignores rankdir, so a direction selects the hierarchical layout
+		d.write([]byte(fmt.Sprintf(d.style.templates.direction, d.config.Direction)))
+	} else {
+		d.write([]byte(d.style.graphHeader))
+	}
+	if d.config.Title != "" {
+		d.write([]byte(fmt.Sprintf(d.style.templates.title, dotEscape(d.config.Title))))
+	}
 	d.write([]byte(d.style.defaults.graph))
 	d.write([]byte(d.style.defaults.node))
 	d.write([]byte(d.style.defaults.edge))
+	if d.config.Stylesheet != "" {
+		d.write([]byte(strings.TrimSuffix(d.config.Stylesheet, "\n") + "\n"))
+	}
 }
 
 func (d *Dot) endGraph() {
 	d.write([]byte("}\n"))
 }
 
+func (d *Dot) beginCluster(name string) {
+	d.write([]byte(fmt.Sprintf(d.style.templates.clusterBegin, name, name)))
+	d.clusterMember(name)
+}
+
+func (d *Dot) clusterMember(name string) {
+	d.write([]byte(fmt.Sprintf(d.style.templates.clusterMember, name)))
+}
+
+func (d *Dot) endCluster() {
+	d.write([]byte("}\n"))
+}
+
 func (d *Dot) edge(a, b, label string) {
 	d.write([]byte(fmt.Sprintf(d.style.templates.edge, a, b, label)))
 }
 
-func (d *Dot) node(name, label, description string) {
-	d.write([]byte(fmt.Sprintf(d.style.templates.node, name, label, description)))
+func (d *Dot) node(state plinko.State, label, description string) {
+	color := d.style.colors.node
+	if highlighted(d.config, state) {
+		color = d.style.colors.highlight
+	}
+
+	var rows string
+	if d.config.IncludeDescriptions {
+		rows = fmt.Sprintf(d.style.templates.description, description)
+	}
+
+	d.write([]byte(fmt.Sprintf(d.style.templates.node, state, color, label, rows)))
+}
+
+// pathArg keeps a relative path that starts with a dash from being read as a flag.
+func pathArg(path string) string {
+	if strings.HasPrefix(path, "-") {
+		return "./" + path
+	}
+
+	return path
 }
 
-// DotFileToImg runs the dot command to convert a dot file into an image file
-func DotFileToImg(from, to, format string) error {
-	_, err := exec.Command("sh", "-c", "dot -T"+format+" "+from+" -o "+to).Output()
-	return err
+func dotEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
+
+// DotFileToImg runs the dot command to convert a dot file into an image file.  The paths are passed to dot
+// as separate arguments, never through a shell, and the command is stopped when the context is done.
+func DotFileToImg(ctx context.Context, from, to, format string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "dot", "-T"+format, "-o"+pathArg(to), pathArg(from))
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return fmt.Errorf("dot failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return fmt.Errorf("dot failed: %w", err)
+	}
+
+	return nil
 }
 
 type dotStylesheet struct {
 	graphHeader string
 	defaults    dotDefaultStyles
+	colors      dotColors
 	templates   dotTemplates
 }
 
+type dotColors struct {
+	node      string
+	highlight string
+}
+
 type dotDefaultStyles struct {
 	graph string
 	node  string
@@ -78,8 +163,15 @@ type dotDefaultStyles struct {
 }
 
 type dotTemplates struct {
-	node string
-	edge string
+	direction     string
+	title         string
+	node          string
+	description   string
+	edge          string
+	clusterBegin  string
+	clusterMember string
+	initial       string
+	terminal      string
 }
 
 var defaultDotStyle = dotStylesheet{
@@ -94,8 +186,19 @@ start=1251;
 		node:  "node [shape=plaintext];\n",
 		edge:  "edge [constraint=true, fontname = \"sans-serif\"];\n",
 	},
+	colors: dotColors{
+		node:      "orange",
+		highlight: "lightblue",
+	},
 	templates: dotTemplates{
-		node: `"%s" [label=<<TABLE STYLE="ROUNDED" BGCOLOR="orange" BORDER="1" CELLSPACING="0" WIDTH="20"><TR><TD BORDER="0">%s</TD></TR><TR><TD BORDER="1" SIDES="t">%s</TD></TR></TABLE>>];` + "\n",
-		edge: "\"%s\" -> \"%s\"[label=\"%s\"];\n",
+		direction:     "layout=dot;\nrankdir=%s;\n",
+		title:         "label=\"%s\";\nlabelloc=\"t\";\n",
+		node:          `"%s" [label=<<TABLE STYLE="ROUNDED" BGCOLOR="%s" BORDER="1" CELLSPACING="0" WIDTH="20"><TR><TD BORDER="0">%s</TD></TR>%s</TABLE>>];` + "\n",
+		description:   `<TR><TD BORDER="1" SIDES="t">%s</TD></TR>`,
+		edge:          "\"%s\" -> \"%s\"[label=\"%s\"];\n",
+		clusterBegin:  "subgraph \"cluster_%s\" {\nlabel=\"%s\";\n",
+		clusterMember: "\"%s\";\n",
+		initial:       "\"__initial\" [shape=point, width=0.2, label=\"\"];\n\"__initial\" -> \"%s\";\n",
+		terminal:      "\"__final_%s\" [shape=doublecircle, width=0.15, label=\"\", style=filled, fillcolor=black];\n\"%s\" -> \"__final_%s\";\n",
 	},
 }
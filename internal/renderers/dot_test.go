@@ -50,3 +50,40 @@ func Test_CreateDot(t *testing.T) {
 	assert.Contains(t, buf.String(), `Very much new order`)
 	assert.Contains(t, buf.String(), `Where it all begins`)
 }
+
+func Test_CreateDotWithSubstates(t *testing.T) {
+	p := config.CreatePlinkoDefinition()
+
+	p.Configure("Active").
+		Permit("Cancel", Canceled)
+
+	p.Configure(Opened).
+		SubstateOf("Active")
+
+	p.Configure(Canceled)
+
+	buf := bytes.NewBufferString("")
+	err := p.Render(renderers.NewDot(buf))
+
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), "subgraph \"cluster_Active\" {\nlabel=\"Active\";\n\"Active\";\n\"Opened\";\n}\n")
+}
+
+func Test_CreateDotWithInitialAndTerminalStates(t *testing.T) {
+	p := config.CreatePlinkoDefinition()
+	p.InitialState(Created)
+
+	p.Configure(Created).
+		Permit("Open", Opened)
+
+	p.Configure(Opened).
+		Terminal()
+
+	buf := bytes.NewBufferString("")
+	err := p.Render(renderers.NewDot(buf))
+
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), "\"__initial\" -> \"Created\";\n")
+	assert.Contains(t, buf.String(), "\"Opened\" -> \"__final_Opened\";\n")
+	assert.NotContains(t, buf.String(), "__final_Created")
+}
@@ -0,0 +1,107 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package renderers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shipt/plinko"
+)
+
+// markers returns the declared initial state and terminal states, in declaration order.
+func markers(graph plinko.Graph) (initial plinko.State, terminals []plinko.State) {
+	graph.Nodes(func(state plinko.State, info plinko.StateConfig) {
+		if info.Initial {
+			initial = state
+		}
+		if info.Terminal {
+			terminals = append(terminals, state)
+		}
+	})
+
+	return initial, terminals
+}
+
+// permitLabel names the trigger of a transition, followed by its guard when it has one.
+func permitLabel(permit plinko.PermitInfo) string {
+	if permit.Guarded {
+		return fmt.Sprintf("%s [%s]", permit.Trigger, permit.GuardName)
+	}
+
+	return string(permit.Trigger)
+}
+
+// displayName drops the package path from a qualified function name, so diagrams show OnNewOrderEntry
+// rather than github.com/org/orders.OnNewOrderEntry.
+func displayName(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+
+	return name
+}
+
+// stateTree holds the superstate relationships declared with SubstateOf.
+type stateTree struct {
+	children map[plinko.State][]plinko.State
+	roots    []plinko.State
+}
+
+func newStateTree(graph plinko.Graph) stateTree {
+	tree := stateTree{children: make(map[plinko.State][]plinko.State)}
+	parents := make(map[plinko.State]plinko.State)
+	var order []plinko.State
+
+	graph.Nodes(func(state plinko.State, info plinko.StateConfig) {
+		order = append(order, state)
+		if info.Parent != "" {
+			parents[state] = info.Parent
+			tree.children[info.Parent] = append(tree.children[info.Parent], state)
+		}
+	})
+
+	for _, state := range order {
+		if _, ok := parents[state]; !ok && len(tree.children[state]) > 0 {
+			tree.roots = append(tree.roots, state)
+		}
+	}
+
+	return tree
+}
+
+// walk visits each composite state depth first, calling enter before its children and exit after them.
+// Leaf substates are reported through leaf.  Cycles are cut at the first repeated state.
+func (t stateTree) walk(enter func(state plinko.State, depth int), leaf func(state plinko.State, depth int), exit func(state plinko.State, depth int)) {
+	visited := make(map[plinko.State]bool)
+
+	var visit func(state plinko.State, depth int)
+	visit = func(state plinko.State, depth int) {
+		if visited[state] {
+			return
+		}
+		visited[state] = true
+
+		if len(t.children[state]) == 0 {
+			leaf(state, depth)
+			return
+		}
+
+		enter(state, depth)
+		for _, child := range t.children[state] {
+			visit(child, depth+1)
+		}
+		exit(state, depth)
+	}
+
+	for _, root := range t.roots {
+		visit(root, 0)
+	}
+}
@@ -0,0 +1,148 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package renderers
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/shipt/plinko"
+)
+
+type Mermaid struct {
+	*writeWrapper
+	config plinko.RenderConfig
+}
+
+func NewMermaid(w io.Writer, opts ...plinko.RenderOption) *Mermaid {
+	return &Mermaid{
+		writeWrapper: &writeWrapper{writer: w},
+		config:       newRenderConfig(opts...),
+	}
+}
+
+func (d *Mermaid) Render(graph plinko.Graph) error {
+	if d.config.Title != "" {
+		d.write([]byte(fmt.Sprintf("---\ntitle: %s\n---\n", d.config.Title)))
+	}
+	d.write([]byte("stateDiagram-v2\n"))
+	if d.config.Direction != "" {
+		d.write([]byte(fmt.Sprintf("    direction %s\n", d.config.Direction)))
+	}
+	if d.config.Stylesheet != "" {
+		for _, line := range strings.Split(strings.TrimSuffix(d.config.Stylesheet, "\n"), "\n") {
+			d.write([]byte(fmt.Sprintf("    %s\n", line)))
+		}
+	}
+
+	ids := mermaidIDs{ids: make(map[plinko.State]string), used: make(map[string]bool)}
+	graph.Nodes(func(state plinko.State, info plinko.StateConfig) {
+		name := string(state)
+		if info.Name != "" {
+			name = info.Name
+		}
+		if id := ids.assign(state); name != id {
+			d.write([]byte(fmt.Sprintf("    state \"%s\" as %s\n", mermaidEscape(name), id)))
+		}
+		if d.config.IncludeDescriptions && info.Description != "" {
+			d.write([]byte(fmt.Sprintf("    %s : %s\n", ids.assign(state), info.Description)))
+		}
+	})
+
+	// id also aliases the states that aren't declared but are the destination of a permit
+	id := func(state plinko.State) string {
+		_, known := ids.ids[state]
+		id := ids.assign(state)
+		if !known && id != string(state) {
+			d.write([]byte(fmt.Sprintf("    state \"%s\" as %s\n", mermaidEscape(string(state)), id)))
+		}
+
+		return id
+	}
+
+	newStateTree(graph).walk(func(state plinko.State, depth int) {
+		d.write([]byte(fmt.Sprintf("%sstate %s {\n", indent(depth), id(state))))
+	}, func(state plinko.State, depth int) {
+		d.write([]byte(fmt.Sprintf("%s%s\n", indent(depth), id(state))))
+	}, func(state plinko.State, depth int) {
+		d.write([]byte(fmt.Sprintf("%s}\n", indent(depth))))
+	})
+
+	initial, terminals := markers(graph)
+	if initial != "" {
+		d.write([]byte(fmt.Sprintf("    [*] --> %s\n", id(initial))))
+	}
+
+	graph.Describe(func(info plinko.StateInfo) {
+		for _, permit := range info.Permits {
+			if permit.Internal {
+				d.write([]byte(fmt.Sprintf("    %s : %s / %s\n", id(info.State), permitLabel(permit), displayName(permit.Operation.Name))))
+			}
+			for _, destination := range permit.Destinations {
+				d.write([]byte(fmt.Sprintf("    %s --> %s : %s\n", id(info.State), id(destination), permitLabel(permit))))
+			}
+		}
+	})
+
+	for _, state := range terminals {
+		d.write([]byte(fmt.Sprintf("    %s --> [*]\n", id(state))))
+	}
+
+	if len(d.config.Highlight) > 0 {
+		d.write([]byte("    classDef highlight fill:#add8e6\n"))
+		for _, state := range d.config.Highlight {
+			d.write([]byte(fmt.Sprintf("    class %s highlight\n", id(state))))
+		}
+	}
+
+	return d.err
+}
+
+// indent nests the states of a composite state below the diagram's own indentation.
+func indent(depth int) string {
+	return strings.Repeat("    ", depth+1)
+}
+
+// mermaidIDs gives each state an identifier Mermaid accepts.  A state name holding anything other than
+// letters, digits and underscores is written with underscores instead, numbered when that collides with
+// another state's identifier, and shown under its own name through a state alias.
+type mermaidIDs struct {
+	ids  map[plinko.State]string
+	used map[string]bool
+}
+
+func (m mermaidIDs) assign(state plinko.State) string {
+	if id, ok := m.ids[state]; ok {
+		return id
+	}
+
+	base := strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, string(state))
+	if base == "" {
+		base = "_"
+	}
+
+	id := base
+	for n := 2; m.used[id]; n++ {
+		id = fmt.Sprintf("%s_%d", base, n)
+	}
+
+	m.ids[state] = id
+	m.used[id] = true
+
+	return id
+}
+
+// mermaidEscape keeps a quoted state name from ending its quotes early.
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, "\"", "#quot;")
+}
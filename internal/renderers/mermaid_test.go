@@ -0,0 +1,120 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package renderers_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/internal/renderers"
+	"github.com/shipt/plinko/pkg/config"
+	"github.com/shipt/plinko/pkg/config/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func IsCancellable(_ context.Context, _ plinko.Payload, _ plinko.TransitionInfo) error {
+	return nil
+}
+
+func Test_CreateMermaid(t *testing.T) {
+	p := config.CreatePlinkoDefinition()
+	p.InitialState(Created)
+
+	p.Configure(Created, state.WithName("New order"), state.WithDescription("Where it all begins")).
+		Permit("Open", Opened).
+		PermitIf(IsCancellable, "Cancel", Canceled)
+
+	p.Configure("Active").
+		Permit("Cancel", Canceled)
+
+	p.Configure(Opened).
+		SubstateOf("Active").
+		InternalTransition("AddItem", OnNewOrderEntry)
+
+	p.Configure(Canceled).
+		Terminal()
+
+	buf := bytes.NewBufferString("")
+	err := p.Render(renderers.NewMermaid(buf))
+
+	assert.Nil(t, err)
+	assert.Equal(t, `stateDiagram-v2
+    state "New order" as Created
+    Created : Where it all begins
+    state Active {
+        Opened
+    }
+    [*] --> Created
+    Created --> Opened : Open
+    Created --> Canceled : Cancel [IsCancellable]
+    Active --> Canceled : Cancel
+    Opened : AddItem / OnNewOrderEntry
+    Canceled --> [*]
+`, buf.String())
+}
+
+func Test_CreateMermaidWithOptions(t *testing.T) {
+	p := config.CreatePlinkoDefinition()
+
+	p.Configure(Created, state.WithDescription("Where it all begins")).
+		Permit("Open", Opened)
+
+	p.Configure(Opened)
+
+	buf := bytes.NewBufferString("")
+	err := p.Render(renderers.NewMermaid(buf, func(c *plinko.RenderConfig) {
+		c.Title = "Orders"
+		c.Direction = plinko.LeftToRight
+		c.IncludeDescriptions = false
+		c.Highlight = []plinko.State{Opened}
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, `---
+title: Orders
+---
+stateDiagram-v2
+    direction LR
+    Created --> Opened : Open
+    classDef highlight fill:#add8e6
+    class Opened highlight
+`, buf.String())
+}
+
+func Test_CreateMermaidAliasesStateIDs(t *testing.T) {
+	p := config.CreatePlinkoDefinition()
+	p.InitialState("New order")
+
+	p.Configure("New order").
+		Permit("Open", "in-progress").
+		Permit("Skip", "in progress")
+
+	p.Configure("in-progress").
+		Permit("Close", "Done")
+
+	p.Configure("in progress", state.WithName("In progress")).
+		Terminal()
+
+	p.Configure("Done")
+
+	buf := bytes.NewBufferString("")
+	err := p.Render(renderers.NewMermaid(buf))
+
+	assert.Nil(t, err)
+	assert.Equal(t, `stateDiagram-v2
+    state "New order" as New_order
+    state "in-progress" as in_progress
+    state "In progress" as in_progress_2
+    [*] --> New_order
+    New_order --> in_progress : Open
+    New_order --> in_progress_2 : Skip
+    in_progress --> Done : Close
+    in_progress_2 --> [*]
+`, buf.String())
+}
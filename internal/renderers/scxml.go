@@ -0,0 +1,167 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package renderers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/shipt/plinko"
+)
+
+// SCXMLNamespace holds the elements and attributes plinko adds to SCXML documents: named operations and the
+// triggers they are limited to, error handlers, dynamic transitions and state descriptions.
+const SCXMLNamespace = "https://github.com/shipt/plinko"
+
+type SCXML struct {
+	*writeWrapper
+	config plinko.RenderConfig
+}
+
+func NewSCXML(w io.Writer, opts ...plinko.RenderOption) *SCXML {
+	return &SCXML{
+		writeWrapper: &writeWrapper{writer: w},
+		config:       newRenderConfig(opts...),
+	}
+}
+
+func (d *SCXML) Render(graph plinko.Graph) error {
+	var order []plinko.State
+	infos := make(map[plinko.State]plinko.StateInfo)
+	children := make(map[plinko.State][]plinko.State)
+
+	graph.Describe(func(info plinko.StateInfo) {
+		order = append(order, info.State)
+		infos[info.State] = info
+	})
+	for _, state := range order {
+		if parent := infos[state].Config.Parent; parent != "" {
+			children[parent] = append(children[parent], state)
+		}
+	}
+
+	initial, _ := markers(graph)
+
+	d.write([]byte(xml.Header))
+	d.write([]byte(fmt.Sprintf(`<scxml xmlns="http://www.w3.org/2005/07/scxml" xmlns:plinko="%s" version="1.0"`, SCXMLNamespace)))
+	if initial != "" {
+		d.write([]byte(fmt.Sprintf(` initial="%s"`, xmlEscape(string(initial)))))
+	}
+	if d.config.Title != "" {
+		d.write([]byte(fmt.Sprintf(` name="%s"`, xmlEscape(d.config.Title))))
+	}
+	d.write([]byte(">\n"))
+
+	visited := make(map[plinko.State]bool)
+	var visit func(state plinko.State, depth int)
+	visit = func(state plinko.State, depth int) {
+		if visited[state] {
+			return
+		}
+		visited[state] = true
+		info := infos[state]
+		pad := strings.Repeat("  ", depth)
+
+		element := "state"
+		if info.Config.Terminal && len(info.Permits) == 0 && len(info.Ignored) == 0 && len(children[state]) == 0 {
+			element = "final"
+		}
+
+		d.write([]byte(fmt.Sprintf(`%s<%s id="%s"`, pad, element, xmlEscape(string(state)))))
+		if d.config.IncludeDescriptions && info.Config.Description != "" {
+			d.write([]byte(fmt.Sprintf(` plinko:description="%s"`, xmlEscape(info.Config.Description))))
+		}
+		d.write([]byte(">\n"))
+
+		d.operations(pad+"  ", "onentry", info.EntryOperations)
+		d.operations(pad+"  ", "onexit", info.ExitOperations)
+		d.operations(pad+"  ", "plinko:onerror", info.ErrorOperations)
+
+		for _, permit := range info.Permits {
+			d.transition(pad+"  ", permit)
+		}
+		for _, trigger := range info.Ignored {
+			d.write([]byte(fmt.Sprintf("%s  <transition event=\"%s\"/>\n", pad, xmlEscape(string(trigger)))))
+		}
+
+		for _, child := range children[state] {
+			visit(child, depth+1)
+		}
+
+		d.write([]byte(fmt.Sprintf("%s</%s>\n", pad, element)))
+	}
+
+	for _, state := range order {
+		if parent := infos[state].Config.Parent; parent == "" || infos[parent].State == "" {
+			visit(state, 1)
+		}
+	}
+	// states caught in a superstate cycle have no top-level ancestor
+	for _, state := range order {
+		visit(state, 1)
+	}
+
+	d.write([]byte("</scxml>\n"))
+	return d.err
+}
+
+func (d *SCXML) operations(pad, element string, operations []plinko.OperationConfig) {
+	if len(operations) == 0 {
+		return
+	}
+
+	d.write([]byte(fmt.Sprintf("%s<%s>\n", pad, element)))
+	for _, operation := range operations {
+		d.write([]byte(fmt.Sprintf("%s  <plinko:operation name=\"%s\"", pad, xmlEscape(operation.Name))))
+		if operation.Trigger != "" {
+			d.write([]byte(fmt.Sprintf(` plinko:trigger="%s"`, xmlEscape(string(operation.Trigger)))))
+		}
+		d.write([]byte("/>\n"))
+	}
+	d.write([]byte(fmt.Sprintf("%s</%s>\n", pad, element)))
+}
+
+// transition writes a permit as an SCXML transition.  Automatic transitions have no event and internal
+// transitions have no target, running their operation in place.  A dynamic transition names its selector
+// and possible destinations in plinko attributes rather than in target, which SCXML would read as
+// entering every destination at once.
+func (d *SCXML) transition(pad string, permit plinko.PermitInfo) {
+	d.write([]byte(pad + "<transition"))
+	if !permit.Automatic {
+		d.write([]byte(fmt.Sprintf(` event="%s"`, xmlEscape(string(permit.Trigger)))))
+	}
+	if permit.Guarded {
+		d.write([]byte(fmt.Sprintf(` cond="%s"`, xmlEscape(permit.GuardName))))
+	}
+
+	if permit.Internal {
+		d.write([]byte(fmt.Sprintf(" type=\"internal\">\n%s  <plinko:operation name=\"%s\"/>\n%s</transition>\n", pad, xmlEscape(permit.Operation.Name), pad)))
+		return
+	}
+
+	var targets []string
+	for _, destination := range permit.Destinations {
+		targets = append(targets, xmlEscape(string(destination)))
+	}
+
+	if permit.Dynamic {
+		d.write([]byte(fmt.Sprintf(` plinko:selector="%s" plinko:targets="%s"/>`+"\n", xmlEscape(permit.SelectorName), strings.Join(targets, " "))))
+		return
+	}
+
+	d.write([]byte(fmt.Sprintf(" target=\"%s\"/>\n", strings.Join(targets, " "))))
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+
+	return b.String()
+}
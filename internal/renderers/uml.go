@@ -9,32 +9,116 @@ package renderers
 import (
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/shipt/plinko"
 )
 
 type UML struct {
 	*writeWrapper
+	config plinko.RenderConfig
 }
 
-func NewUML(w io.Writer) *UML {
+func NewUML(w io.Writer, opts ...plinko.RenderOption) *UML {
 	return &UML{
 		writeWrapper: &writeWrapper{writer: w},
+		config:       newRenderConfig(opts...),
 	}
 }
 
 func (d *UML) Render(graph plinko.Graph) error {
 	d.write([]byte("@startuml\n"))
+	d.header()
 
-	firstEdge := true
-	graph.Edges(func(state, destinationState plinko.State, name plinko.Trigger) {
-		if firstEdge {
-			d.write([]byte(fmt.Sprintf("[*] -> %s \n", state)))
-			firstEdge = false
+	declared := make(map[plinko.State]bool)
+	newStateTree(graph).walk(func(state plinko.State, depth int) {
+		declared[state] = true
+		d.write([]byte(fmt.Sprintf("%sstate %s%s {\n", strings.Repeat("  ", depth), state, d.color(state))))
+	}, func(state plinko.State, depth int) {
+		declared[state] = true
+		d.write([]byte(fmt.Sprintf("%sstate %s%s\n", strings.Repeat("  ", depth), state, d.color(state))))
+	}, func(state plinko.State, depth int) {
+		d.write([]byte(fmt.Sprintf("%s}\n", strings.Repeat("  ", depth))))
+	})
+
+	graph.Describe(func(info plinko.StateInfo) {
+		if !declared[info.State] && highlighted(d.config, info.State) {
+			d.write([]byte(fmt.Sprintf("state %s%s\n", info.State, d.color(info.State))))
+		}
+		if d.config.IncludeDescriptions && info.Config.Description != "" {
+			d.write([]byte(fmt.Sprintf("%s : %s\n", info.State, info.Config.Description)))
+		}
+		d.actions(info.State, "entry", info.EntryOperations)
+		d.actions(info.State, "exit", info.ExitOperations)
+		d.actions(info.State, "error", info.ErrorOperations)
+		for _, permit := range info.Permits {
+			if permit.Internal {
+				d.write([]byte(fmt.Sprintf("%s : %s / %s\n", info.State, permitLabel(permit), displayName(permit.Operation.Name))))
+			}
 		}
-		d.write([]byte(fmt.Sprintf("%s --> %s : %s\n", state, destinationState, name)))
 	})
 
+	initial, terminals := markers(graph)
+	if initial != "" {
+		d.write([]byte(fmt.Sprintf("[*] --> %s\n", initial)))
+	}
+
+	// without a declared initial state, the start marker points to the source of the first edge
+	firstEdge := initial == ""
+	graph.Describe(func(info plinko.StateInfo) {
+		for _, permit := range info.Permits {
+			for _, destination := range permit.Destinations {
+				if firstEdge {
+					d.write([]byte(fmt.Sprintf("[*] -> %s \n", info.State)))
+					firstEdge = false
+				}
+				d.write([]byte(fmt.Sprintf("%s --> %s : %s\n", info.State, destination, permitLabel(permit))))
+			}
+		}
+	})
+
+	for _, state := range terminals {
+		d.write([]byte(fmt.Sprintf("%s --> [*]\n", state)))
+	}
+
 	d.write([]byte("@enduml"))
-	return nil
+	return d.err
+}
+
+func (d *UML) header() {
+	if d.config.Title != "" {
+		d.write([]byte(fmt.Sprintf("title %s\n", d.config.Title)))
+	}
+
+	// PlantUML has no bottom to top or right to left layout, those keep the default
+	switch d.config.Direction {
+	case plinko.LeftToRight:
+		d.write([]byte("left to right direction\n"))
+	case plinko.TopToBottom:
+		d.write([]byte("top to bottom direction\n"))
+	}
+
+	if d.config.Stylesheet != "" {
+		d.write([]byte(strings.TrimSuffix(d.config.Stylesheet, "\n") + "\n"))
+	}
+}
+
+// actions lists the operations of a chain in the body of the state, as in "entry / OnNewOrderEntry", or
+// "entry [Submit] / OnSubmitEntry" for an operation that only runs on one trigger.
+func (d *UML) actions(state plinko.State, kind string, operations []plinko.OperationConfig) {
+	for _, operation := range operations {
+		if operation.Trigger != "" {
+			d.write([]byte(fmt.Sprintf("%s : %s [%s] / %s\n", state, kind, operation.Trigger, displayName(operation.Name))))
+			continue
+		}
+		d.write([]byte(fmt.Sprintf("%s : %s / %s\n", state, kind, displayName(operation.Name))))
+	}
+}
+
+func (d *UML) color(state plinko.State) string {
+	if highlighted(d.config, state) {
+		return " #LightBlue"
+	}
+
+	return ""
 }
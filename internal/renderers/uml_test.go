@@ -8,10 +8,13 @@ package renderers_test
 
 import (
 	"bytes"
+	"context"
 	"testing"
 
+	"github.com/shipt/plinko"
 	"github.com/shipt/plinko/internal/renderers"
 	"github.com/shipt/plinko/pkg/config"
+	"github.com/shipt/plinko/pkg/config/state"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -36,3 +39,100 @@ func Test_CreateUML(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Contains(t, buf.String(), "UnderReview --> PublishedOrder : CompleteReview")
 }
+
+func Test_CreateUMLWithSubstates(t *testing.T) {
+	p := config.CreatePlinkoDefinition()
+
+	p.Configure("Active").
+		Permit("Cancel", Canceled)
+
+	p.Configure(Opened).
+		SubstateOf("Active").
+		Permit("Claim", Claimed)
+
+	p.Configure(Claimed).
+		SubstateOf("Active").
+		Permit("Submit", ArriveAtStore)
+
+	p.Configure(ArriveAtStore).
+		SubstateOf(Claimed)
+
+	p.Configure(Canceled)
+
+	buf := bytes.NewBufferString("")
+	err := p.Render(renderers.NewUML(buf))
+
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), "state Active {\n  state Opened\n  state Claimed {\n    state ArrivedAtStore\n  }\n}\n")
+	assert.Contains(t, buf.String(), "Active --> Canceled : Cancel")
+}
+
+func Test_CreateUMLWithInitialAndTerminalStates(t *testing.T) {
+	p := config.CreatePlinkoDefinition()
+	p.InitialState(Created)
+
+	p.Configure(Opened).
+		Permit("Claim", Claimed)
+
+	p.Configure(Created).
+		Permit("Open", Opened)
+
+	p.Configure(Claimed).
+		Terminal()
+
+	buf := bytes.NewBufferString("")
+	err := p.Render(renderers.NewUML(buf))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "@startuml\n[*] --> Created\nOpened --> Claimed : Claim\nCreated --> Opened : Open\nClaimed --> [*]\n@enduml", buf.String())
+}
+
+func OnNewOrderEntry(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+	return p, nil
+}
+
+func OnNewOrderExit(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+	return p, nil
+}
+
+func RedirectOnFailure(_ context.Context, p plinko.Payload, _ plinko.ModifiableTransitionInfo, err error) (plinko.Payload, error) {
+	return p, err
+}
+
+func Test_CreateUMLWithActionsAndGuards(t *testing.T) {
+	p := config.CreatePlinkoDefinition()
+	p.InitialState(NewOrder)
+
+	p.Configure(NewOrder, state.WithDescription("Where it all begins")).
+		OnEntry(OnNewOrderEntry).
+		OnExit(OnNewOrderExit).
+		OnError(RedirectOnFailure).
+		Permit("Submit", Opened).
+		PermitIf(IsCancellable, "Cancel", Canceled)
+
+	p.Configure(Opened).
+		OnTriggerEntry("Submit", OnNewOrderEntry).
+		Permit("Cancel", Canceled).
+		InternalTransition("AddItem", OnNewOrderEntry)
+
+	p.Configure(Canceled).
+		Terminal()
+
+	buf := bytes.NewBufferString("")
+	err := p.Render(renderers.NewUML(buf))
+
+	assert.Nil(t, err)
+	assert.Equal(t, `@startuml
+NewOrder : Where it all begins
+NewOrder : entry / OnNewOrderEntry
+NewOrder : exit / OnNewOrderExit
+NewOrder : error / RedirectOnFailure
+Opened : entry [Submit] / OnNewOrderEntry
+Opened : AddItem / OnNewOrderEntry
+[*] --> NewOrder
+NewOrder --> Opened : Submit
+NewOrder --> Canceled : Cancel [IsCancellable]
+Opened --> Canceled : Cancel
+Canceled --> [*]
+@enduml`, buf.String())
+}
@@ -0,0 +1,311 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/shipt/plinko"
+)
+
+// analyzeGraph reports the states that can't be reached from the initial state and, when the definition
+// has terminal states, the reachable states from which none of them can be reached.  Without an initial
+// state the graph can't be analyzed, which is reported as a warning of its own.
+func (pd PlinkoDefinition) analyzeGraph() []plinko.CompilerMessage {
+	if pd.Initial == "" {
+		if len(pd.Abs.StateDefinitions) == 0 {
+			return nil
+		}
+
+		return []plinko.CompilerMessage{{
+			CompileMessage: plinko.CompileWarning,
+			Message:        "No initial state declared: reachability isn't analyzed.",
+			Code:           plinko.MissingInitialStateCode,
+		}}
+	}
+
+	if (*pd.States)[pd.Initial] == nil {
+		return []plinko.CompilerMessage{{
+			CompileMessage: plinko.CompileError,
+			Message:        fmt.Sprintf("State '%s' undefined: it is declared as the initial state.", pd.Initial),
+			Code:           plinko.UndefinedInitialStateCode,
+		}}
+	}
+
+	var messages []plinko.CompilerMessage
+	reachable := pd.reachableFrom(pd.Initial)
+
+	var states []plinko.State
+	for _, sd := range pd.Abs.StateDefinitions {
+		if reachable[sd.State] {
+			states = append(states, sd.State)
+			continue
+		}
+
+		// a superstate that is never entered itself still groups the substates that are
+		if !pd.hasReachableSubstate(sd.State, reachable) {
+			messages = append(messages, plinko.CompilerMessage{
+				CompileMessage: plinko.CompileWarning,
+				Message:        fmt.Sprintf("State '%s' can't be reached from the initial state '%s'.", sd.State, pd.Initial),
+				Code:           plinko.UnreachableStateCode,
+			})
+		}
+	}
+
+	terminating := pd.terminatingStates(states)
+	if len(terminating) == 0 {
+		// without terminal states the machine is meant to run in cycles
+		return messages
+	}
+
+	trapped := make(map[plinko.State]bool)
+	for _, component := range pd.stronglyConnectedComponents(states) {
+		if !pd.inescapable(component) {
+			continue
+		}
+
+		for _, state := range component {
+			trapped[state] = true
+		}
+		messages = append(messages, plinko.CompilerMessage{
+			CompileMessage: plinko.CompileWarning,
+			Message:        fmt.Sprintf("States %s form a cycle that can't be left.", quoteStates(component)),
+			Code:           plinko.InescapableComponentCode,
+		})
+	}
+
+	for _, state := range states {
+		if !terminating[state] && !trapped[state] {
+			messages = append(messages, plinko.CompilerMessage{
+				CompileMessage: plinko.CompileWarning,
+				Message:        fmt.Sprintf("No terminal state can be reached from State '%s'.", state),
+				Code:           plinko.NoTerminalStateReachableCode,
+			})
+		}
+	}
+
+	return messages
+}
+
+// unusedTriggers returns the triggers named by OnTriggerEntry, OnTriggerExit or Ignore that no state
+// permits, in the order they were first referenced.
+func (pd PlinkoDefinition) unusedTriggers() []plinko.Trigger {
+	var unused []plinko.Trigger
+	seen := make(map[plinko.Trigger]bool)
+
+	for _, trigger := range pd.Abs.TriggerReferences {
+		if seen[trigger] {
+			continue
+		}
+		seen[trigger] = true
+
+		if !pd.triggerUsed(trigger) {
+			unused = append(unused, trigger)
+		}
+	}
+
+	return unused
+}
+
+// successors returns the defined states the state can move to, through its own or inherited permits and
+// its completion transitions, in declaration order.
+func (pd PlinkoDefinition) successors(state plinko.State) []plinko.State {
+	var states []plinko.State
+	add := func(destination plinko.State) {
+		if (*pd.States)[destination] != nil && !findDestinationState(states, destination) {
+			states = append(states, destination)
+		}
+	}
+
+	for _, trigger := range pd.declaredTriggers(state) {
+		for _, td := range pd.findTrigger(state, trigger) {
+			for _, destination := range td.Destinations() {
+				add(destination)
+			}
+		}
+	}
+
+	if sd := (*pd.States)[state]; sd != nil && sd.AutoTransitions != nil {
+		for _, td := range *sd.AutoTransitions {
+			add(td.DestinationState)
+		}
+	}
+
+	return states
+}
+
+func (pd PlinkoDefinition) reachableFrom(initial plinko.State) map[plinko.State]bool {
+	reachable := map[plinko.State]bool{initial: true}
+	queue := []plinko.State{initial}
+
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		for _, next := range pd.successors(state) {
+			if !reachable[next] {
+				reachable[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return reachable
+}
+
+func (pd PlinkoDefinition) hasReachableSubstate(state plinko.State, reachable map[plinko.State]bool) bool {
+	for candidate := range reachable {
+		for _, sd := range pd.ancestry(candidate) {
+			if sd.State == state {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isTerminal reports whether the state is an intended end of the machine.  Once a state is declared
+// terminal only declared states count, otherwise every state without outgoing transitions does.
+func (pd PlinkoDefinition) isTerminal(state plinko.State) bool {
+	if pd.hasDeclaredTerminals() {
+		return (*pd.States)[state].info.Terminal
+	}
+
+	return len(pd.successors(state)) == 0
+}
+
+func (pd PlinkoDefinition) hasDeclaredTerminals() bool {
+	for _, sd := range pd.Abs.StateDefinitions {
+		if sd.info.Terminal {
+			return true
+		}
+	}
+
+	return false
+}
+
+// terminatingStates returns the states from which a terminal state can be reached.
+func (pd PlinkoDefinition) terminatingStates(states []plinko.State) map[plinko.State]bool {
+	terminating := make(map[plinko.State]bool)
+	for _, state := range states {
+		if pd.isTerminal(state) {
+			terminating[state] = true
+		}
+	}
+
+	if len(terminating) == 0 {
+		return terminating
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, state := range states {
+			if terminating[state] {
+				continue
+			}
+
+			for _, next := range pd.successors(state) {
+				if terminating[next] {
+					terminating[state] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	return terminating
+}
+
+// stronglyConnectedComponents partitions the states with Tarjan's algorithm.  Components are returned in
+// the order they are completed and list their states in declaration order.
+func (pd PlinkoDefinition) stronglyConnectedComponents(states []plinko.State) [][]plinko.State {
+	index := make(map[plinko.State]int)
+	lowLink := make(map[plinko.State]int)
+	onStack := make(map[plinko.State]bool)
+	var stack []plinko.State
+	var components [][]plinko.State
+
+	var connect func(state plinko.State)
+	connect = func(state plinko.State) {
+		index[state] = len(index)
+		lowLink[state] = index[state]
+		stack = append(stack, state)
+		onStack[state] = true
+
+		for _, next := range pd.successors(state) {
+			if _, visited := index[next]; !visited {
+				connect(next)
+				if lowLink[next] < lowLink[state] {
+					lowLink[state] = lowLink[next]
+				}
+			} else if onStack[next] && index[next] < lowLink[state] {
+				lowLink[state] = index[next]
+			}
+		}
+
+		if lowLink[state] != index[state] {
+			return
+		}
+
+		members := make(map[plinko.State]bool)
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			members[top] = true
+
+			if top == state {
+				break
+			}
+		}
+
+		var component []plinko.State
+		for _, s := range states {
+			if members[s] {
+				component = append(component, s)
+			}
+		}
+		components = append(components, component)
+	}
+
+	for _, state := range states {
+		if _, visited := index[state]; !visited {
+			connect(state)
+		}
+	}
+
+	return components
+}
+
+// inescapable reports whether the states form a cycle that has no transition leading out of it.
+func (pd PlinkoDefinition) inescapable(component []plinko.State) bool {
+	cycle := len(component) > 1
+
+	for _, state := range component {
+		for _, next := range pd.successors(state) {
+			if !findDestinationState(component, next) {
+				return false
+			}
+			if next == state {
+				cycle = true
+			}
+		}
+	}
+
+	return cycle
+}
+
+func quoteStates(states []plinko.State) string {
+	quoted := make([]plinko.State, 0, len(states))
+	for _, state := range states {
+		quoted = append(quoted, plinko.State(fmt.Sprintf("'%s'", state)))
+	}
+
+	return formatStates(quoted, ", ")
+}
@@ -0,0 +1,95 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package runtime
+
+import (
+	"context"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/internal/sideeffects"
+)
+
+// selectAutoTransition returns the first completion transition of the state, in declaration order, whose
+// guard passes, or nil when there is none.
+func (pd PlinkoDefinition) selectAutoTransition(ctx context.Context, payload plinko.Payload, state plinko.State) *TriggerDefinition {
+	sd := (*pd.States)[state]
+	if sd == nil || sd.AutoTransitions == nil {
+		return nil
+	}
+
+	for _, td := range *sd.AutoTransitions {
+		if td.Predicate == nil {
+			return td
+		}
+
+		err := td.checkGuard(ctx, payload, sideeffects.TransitionDef{
+			Source:      state,
+			Destination: td.DestinationState,
+			Trigger:     plinko.CompletionTrigger,
+		})
+
+		if err == nil {
+			return td
+		}
+	}
+
+	return nil
+}
+
+func (pd PlinkoDefinition) maxAutoTransitions() int {
+	if pd.Config.MaxAutoTransitions <= 0 {
+		return plinko.DefaultMaxAutoTransitions
+	}
+
+	return pd.Config.MaxAutoTransitions
+}
+
+// unconditionalAutoTransition returns the destination a state always moves on to, which is the case when
+// its first completion transition is unguarded.
+func (pd PlinkoDefinition) unconditionalAutoTransition(state plinko.State) (plinko.State, bool) {
+	sd := (*pd.States)[state]
+	if sd == nil || sd.AutoTransitions == nil || len(*sd.AutoTransitions) == 0 {
+		return "", false
+	}
+
+	td := (*sd.AutoTransitions)[0]
+
+	return td.DestinationState, td.Predicate == nil
+}
+
+// autoTransitionCycles returns each cycle of unconditional completion transitions once, starting from the
+// state of the cycle that was configured first.
+func (pd PlinkoDefinition) autoTransitionCycles() [][]plinko.State {
+	var cycles [][]plinko.State
+	reported := make(map[plinko.State]bool)
+
+	for _, sd := range pd.Abs.StateDefinitions {
+		if reported[sd.State] {
+			continue
+		}
+
+		chain := []plinko.State{sd.State}
+		for next, ok := pd.unconditionalAutoTransition(sd.State); ok; next, ok = pd.unconditionalAutoTransition(next) {
+			if next == sd.State {
+				for _, state := range chain {
+					reported[state] = true
+				}
+				cycles = append(cycles, append(chain, next))
+				break
+			}
+
+			if findDestinationState(chain, next) {
+				// the cycle doesn't include this state, it's reported from one of its own states
+				break
+			}
+
+			chain = append(chain, next)
+		}
+	}
+
+	return cycles
+}
@@ -0,0 +1,142 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package runtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/plinkoerror"
+	"github.com/stretchr/testify/assert"
+)
+
+const Shopping plinko.State = "Shopping"
+
+func MutableConditionMet(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) error {
+	if p.(*mutablePayload).condition {
+		return nil
+	}
+
+	return errors.New("condition not met")
+}
+
+func TestFireFollowsAutoTransitions(t *testing.T) {
+	var steps []string
+	p := createPlinkoDefinition()
+
+	p.Configure(Claimed).
+		Permit(Submit, ArriveAtStore)
+
+	p.Configure(ArriveAtStore).
+		OnEntry(RecordStep(&steps, "enter ArrivedAtStore")).
+		OnExit(RecordStep(&steps, "exit ArrivedAtStore")).
+		PermitAutoIf(MutableConditionMet, Shopping)
+
+	p.Configure(Shopping).
+		OnEntry(RecordStep(&steps, "enter Shopping"))
+
+	var transitions []plinko.Trigger
+	p.FilteredSideEffect(plinko.AllowAfterTransition, func(_ context.Context, _ plinko.StateAction, _ plinko.Payload, ti plinko.TransitionInfo, _ int64) {
+		transitions = append(transitions, ti.GetTrigger())
+	})
+
+	psm := p.Compile().StateMachine
+
+	payload := &mutablePayload{testPayload: testPayload{state: Claimed, condition: true}}
+	pr, err := psm.Fire(context.TODO(), payload, Submit)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Shopping, pr.GetState())
+	assert.Equal(t, []plinko.State{ArriveAtStore, Shopping}, payload.history)
+	assert.Equal(t, []string{"enter ArrivedAtStore", "exit ArrivedAtStore", "enter Shopping"}, steps)
+	assert.Equal(t, []plinko.Trigger{Submit, plinko.CompletionTrigger}, transitions)
+
+	// guard doesn't hold, the payload stays in the pass-through state
+	payload = &mutablePayload{testPayload: testPayload{state: Claimed}}
+	pr, err = psm.Fire(context.TODO(), payload, Submit)
+
+	assert.Nil(t, err)
+	assert.Equal(t, ArriveAtStore, pr.GetState())
+}
+
+func TestFireStopsAtMaxAutoTransitions(t *testing.T) {
+	p := createPlinkoDefinitionWithConfig(plinko.DefinitionConfig{MaxAutoTransitions: 2})
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		PermitAutoIf(MutableConditionMet, Claimed)
+
+	p.Configure(Claimed).
+		PermitAutoIf(MutableConditionMet, Opened)
+
+	psm := p.Compile().StateMachine
+
+	payload := &mutablePayload{testPayload: testPayload{state: Created, condition: true}}
+	pr, err := psm.Fire(context.TODO(), payload, Open)
+
+	var pte *plinkoerror.PlinkoTriggerError
+	assert.True(t, errors.As(err, &pte))
+	assert.Equal(t, plinko.CompletionTrigger, pte.Trigger)
+	assert.Equal(t, "Automatic transitions exceeded the maximum chain length of 2 at state: Opened", err.Error())
+	assert.Equal(t, []plinko.State{Opened, Claimed, Opened}, payload.history)
+	assert.Equal(t, Opened, pr.GetState())
+}
+
+func TestCompileAutoTransitionCycles(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		PermitAuto(Opened)
+
+	p.Configure(Opened).
+		PermitAuto(Claimed)
+
+	p.Configure(Claimed).
+		PermitAuto(Opened)
+
+	p.Configure(Delivered).
+		PermitAuto(Delivered)
+
+	p.Configure(Returned).
+		PermitAutoIf(PermitIfPredicate, Canceled).
+		PermitAuto(Returned)
+
+	p.Configure(Canceled).
+		PermitAutoIf(PermitIfPredicate, Returned)
+
+	co := p.Compile()
+
+	assert.Equal(t, []plinko.CompilerMessage{{
+		CompileMessage: plinko.CompileError,
+		Message:        "Automatic transitions form an unconditional cycle: Opened -> Claimed -> Opened.",
+		Code:           plinko.AutoTransitionCycleCode,
+	}, {
+		CompileMessage: plinko.CompileError,
+		Message:        "Automatic transitions form an unconditional cycle: Delivered -> Delivered.",
+		Code:           plinko.AutoTransitionCycleCode,
+	}, missingInitialState}, co.Messages)
+
+	assert.Panics(t, func() {
+		p.Configure(Shopping).
+			PermitAuto(Opened).
+			PermitAuto(Claimed)
+	})
+}
+
+func TestCompletionTriggerIsReserved(t *testing.T) {
+	p := createPlinkoDefinition()
+	sd := p.Configure(Opened)
+
+	assert.Panics(t, func() { sd.Permit(plinko.CompletionTrigger, Claimed) })
+	assert.Panics(t, func() { sd.PermitReentry(plinko.CompletionTrigger) })
+	assert.Panics(t, func() { sd.InternalTransition(plinko.CompletionTrigger, RecordStep(nil, "")) })
+	assert.Panics(t, func() { sd.Ignore(plinko.CompletionTrigger) })
+}
@@ -9,9 +9,12 @@ package runtime
 import (
 	"bytes"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/shipt/plinko"
 	"github.com/shipt/plinko/internal/renderers"
+	"github.com/shipt/plinko/plinkoerror"
 )
 
 func (pd PlinkoDefinition) Compile() plinko.CompilerOutput {
@@ -19,35 +22,214 @@ func (pd PlinkoDefinition) Compile() plinko.CompilerOutput {
 	var compilerMessages []plinko.CompilerMessage
 
 	for _, def := range pd.Abs.TriggerDefinitions {
-		if !findDestinationState(pd.Abs.States, def.DestinationState) {
+		if def.DestinationSelector != nil && len(def.PossibleDestinations) == 0 {
 			compilerMessages = append(compilerMessages, plinko.CompilerMessage{
 				CompileMessage: plinko.CompileError,
-				Message:        fmt.Sprintf("State '%s' undefined: Trigger '%s' declares a transition to this undefined state.", def.DestinationState, def.Name),
+				Message:        fmt.Sprintf("Trigger '%s' declares a dynamic transition without any possible destination states.", def.Name),
+				Code:           plinko.MissingDestinationsCode,
 			})
 		}
+
+		for _, destination := range def.Destinations() {
+			if !findDestinationState(pd.Abs.States, destination) {
+				compilerMessages = append(compilerMessages, plinko.CompilerMessage{
+					CompileMessage: plinko.CompileError,
+					Message:        fmt.Sprintf("State '%s' undefined: Trigger '%s' declares a transition to this undefined state.", destination, def.Name),
+					Code:           plinko.UndefinedStateCode,
+				})
+			}
+		}
 	}
 
 	for _, def := range pd.Abs.StateDefinitions {
-		if len(def.Triggers) == 0 {
+		if def.info.Parent == "" {
+			continue
+		}
+
+		if !findDestinationState(pd.Abs.States, def.info.Parent) {
+			compilerMessages = append(compilerMessages, plinko.CompilerMessage{
+				CompileMessage: plinko.CompileError,
+				Message:        fmt.Sprintf("State '%s' undefined: State '%s' declares it as a superstate.", def.info.Parent, def.State),
+				Code:           plinko.UndefinedStateCode,
+			})
+		} else if chain := pd.superstateCycle(def.State); chain != nil {
+			compilerMessages = append(compilerMessages, plinko.CompilerMessage{
+				CompileMessage: plinko.CompileError,
+				Message:        fmt.Sprintf("State '%s' is its own superstate: %s.", def.State, formatStates(chain, " -> ")),
+				Code:           plinko.SuperstateCycleCode,
+			})
+		}
+	}
+
+	for _, def := range pd.Abs.StateDefinitions {
+		if def.info.Terminal {
+			if len(def.Triggers) > 0 || len(*def.AutoTransitions) > 0 {
+				compilerMessages = append(compilerMessages, plinko.CompilerMessage{
+					CompileMessage: plinko.CompileWarning,
+					Message:        fmt.Sprintf("State '%s' is declared terminal but permits transitions.", def.State),
+					Code:           plinko.TerminalStateTransitionsCode,
+				})
+			}
+			continue
+		}
+
+		if !pd.hasTriggers(def.State) {
 			compilerMessages = append(compilerMessages, plinko.CompilerMessage{
 				CompileMessage: plinko.CompileWarning,
 				Message:        fmt.Sprintf("State '%s' is a state without any triggers (deadend state).", def.State),
+				Code:           plinko.DeadEndStateCode,
+			})
+		}
+	}
+
+	reported := make(map[stateTrigger]bool)
+	for _, def := range pd.Abs.TriggerDefinitions {
+		key := stateTrigger{state: def.Source, trigger: def.Name}
+		permits := (*pd.States)[def.Source].Triggers[def.Name]
+
+		if !reported[key] && len(permits) > 1 && hasUnguardedPermit(permits) {
+			reported[key] = true
+			compilerMessages = append(compilerMessages, plinko.CompilerMessage{
+				CompileMessage: plinko.CompileWarning,
+				Message:        fmt.Sprintf("State '%s' declares an unguarded permit for Trigger '%s' that is only taken when none of its guarded permits passes.", def.Source, def.Name),
+				Code:           plinko.ShadowedPermitCode,
+			})
+		}
+	}
+
+	for _, cycle := range pd.autoTransitionCycles() {
+		compilerMessages = append(compilerMessages, plinko.CompilerMessage{
+			CompileMessage: plinko.CompileError,
+			Message:        fmt.Sprintf("Automatic transitions form an unconditional cycle: %s.", formatStates(cycle, " -> ")),
+			Code:           plinko.AutoTransitionCycleCode,
+		})
+	}
+
+	for _, trigger := range pd.parameterizedTriggers() {
+		if !pd.triggerUsed(trigger) {
+			compilerMessages = append(compilerMessages, plinko.CompilerMessage{
+				CompileMessage: plinko.CompileWarning,
+				Message:        fmt.Sprintf("Trigger '%s' declares parameters but is not permitted by any state.", trigger),
+				Code:           plinko.UnusedTriggerParametersCode,
 			})
 		}
 	}
 
+	for _, trigger := range pd.unusedTriggers() {
+		compilerMessages = append(compilerMessages, plinko.CompilerMessage{
+			CompileMessage: plinko.CompileWarning,
+			Message:        fmt.Sprintf("Trigger '%s' is referenced but not permitted by any state.", trigger),
+			Code:           plinko.UnusedTriggerCode,
+		})
+	}
+
+	compilerMessages = append(compilerMessages, pd.analyzeGraph()...)
+	compilerMessages = append(compilerMessages, pd.lint()...)
+	compilerMessages = pd.promoteWarnings(compilerMessages)
+
 	psm := plinkoStateMachine{
-		pd: pd,
+		pd: pd.freeze(),
 	}
 
 	co := plinko.CompilerOutput{
 		Messages:     compilerMessages,
 		StateMachine: psm,
+		Fingerprint:  pd.fingerprint(),
 	}
 
 	return co
 }
 
+// CompileStrict compiles the definition like Compile, but only returns a state machine when there are no
+// compile errors.  Otherwise the error is a PlinkoCompileError holding every compiler message.
+func (pd PlinkoDefinition) CompileStrict() (plinko.StateMachine, error) {
+	co := pd.Compile()
+
+	for _, m := range co.Messages {
+		if m.CompileMessage == plinko.CompileError {
+			return nil, plinkoerror.CreatePlinkoCompileError(co.Messages)
+		}
+	}
+
+	return co.StateMachine, nil
+}
+
+// superstateCycle returns the chain of superstates leading from the state back to itself, or nil when
+// the state's ancestry terminates.
+func (pd PlinkoDefinition) superstateCycle(state plinko.State) []plinko.State {
+	chain := []plinko.State{state}
+
+	for sd := (*pd.States)[state]; sd != nil && sd.info.Parent != ""; sd = (*pd.States)[sd.info.Parent] {
+		if findDestinationState(chain, sd.info.Parent) {
+			if sd.info.Parent != state {
+				// the cycle doesn't pass through this state, it's reported on the states that form it
+				return nil
+			}
+			return append(chain, sd.info.Parent)
+		}
+		chain = append(chain, sd.info.Parent)
+	}
+
+	return nil
+}
+
+// parameterizedTriggers returns the triggers declared with TriggerParameters in a stable order.
+func (pd PlinkoDefinition) parameterizedTriggers() []plinko.Trigger {
+	triggers := make([]plinko.Trigger, 0, len(pd.Parameters))
+	for trigger := range pd.Parameters {
+		triggers = append(triggers, trigger)
+	}
+
+	sort.Slice(triggers, func(i, j int) bool { return triggers[i] < triggers[j] })
+
+	return triggers
+}
+
+func (pd PlinkoDefinition) triggerUsed(trigger plinko.Trigger) bool {
+	for _, def := range pd.Abs.TriggerDefinitions {
+		if def.Name == trigger {
+			return true
+		}
+	}
+
+	return false
+}
+
+type stateTrigger struct {
+	state   plinko.State
+	trigger plinko.Trigger
+}
+
+func hasUnguardedPermit(permits []*TriggerDefinition) bool {
+	for _, td := range permits {
+		if td.Predicate == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasTriggers reports whether the state declares triggers or inherits them from a superstate.
+func (pd PlinkoDefinition) hasTriggers(state plinko.State) bool {
+	for _, sd := range pd.ancestry(state) {
+		if len(sd.Triggers) > 0 || (sd.AutoTransitions != nil && len(*sd.AutoTransitions) > 0) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatStates(states []plinko.State, sep string) string {
+	names := make([]string, 0, len(states))
+	for _, state := range states {
+		names = append(names, string(state))
+	}
+
+	return strings.Join(names, sep)
+}
+
 func (pd PlinkoDefinition) RenderUml() (plinko.Uml, error) {
 	cm := pd.Compile()
 
@@ -64,22 +246,50 @@ func (pd PlinkoDefinition) RenderUml() (plinko.Uml, error) {
 	return plinko.Uml(b.String()), err
 }
 
+func (pd PlinkoDefinition) RenderMermaid() (plinko.Mermaid, error) {
+	cm := pd.Compile()
+
+	for _, def := range cm.Messages {
+		if def.CompileMessage == plinko.CompileError {
+			return "", fmt.Errorf("critical errors exist in definition")
+		}
+	}
+
+	b := bytes.NewBuffer([]byte{})
+	r := renderers.NewMermaid(b)
+	err := pd.Render(r)
+
+	return plinko.Mermaid(b.String()), err
+}
+
 func (pd PlinkoDefinition) Render(renderer plinko.Renderer) error {
 	return renderer.Render(pd)
 }
 
-// Edges implements Edges method of the plinko.Graph interface
+// Edges implements Edges method of the plinko.Graph interface, reporting the permits of each state in
+// declaration order.
 func (pd PlinkoDefinition) Edges(edgeFunc func(state, destinationState plinko.State, name plinko.Trigger)) {
-	for _, sd := range pd.Abs.StateDefinitions {
-		for _, td := range sd.Triggers {
-			edgeFunc(sd.State, td.DestinationState, td.Name)
+	pd.Describe(func(info plinko.StateInfo) {
+		for _, permit := range info.Permits {
+			for _, destination := range permit.Destinations {
+				edgeFunc(info.State, destination, permit.Trigger)
+			}
 		}
+	})
+}
+
+// Describe implements Describe method of the plinko.Graph interface
+func (pd PlinkoDefinition) Describe(stateFunc func(plinko.StateInfo)) {
+	for _, sd := range pd.Abs.StateDefinitions {
+		stateFunc(pd.stateInfo(sd))
 	}
 }
 
 // Nodes implements Nodes method of the plinko.Graph interface
 func (pd PlinkoDefinition) Nodes(nodeFunc func(state plinko.State, StateConfig plinko.StateConfig)) {
 	for _, sd := range pd.Abs.StateDefinitions {
-		nodeFunc(sd.State, sd.info)
+		info := *sd.info
+		info.Initial = sd.State == pd.Initial
+		nodeFunc(sd.State, info)
 	}
 }
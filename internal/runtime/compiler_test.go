@@ -7,8 +7,14 @@
 package runtime
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
 
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/plinkoerror"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -36,3 +42,489 @@ func TestRenderUmlWithBadDefinition(t *testing.T) {
 	assert.NotNil(t, e)
 	assert.NotNil(t, o)
 }
+
+func TestCompileSuperstateErrors(t *testing.T) {
+	p := createPlinkoDefinition()
+	p.InitialState(Created)
+
+	p.Configure(Created).
+		SubstateOf("Undefined").
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		SubstateOf(Claimed).
+		Permit(Open, Opened)
+
+	p.Configure(Claimed).
+		SubstateOf(Opened)
+
+	co := p.Compile()
+
+	var messages []string
+	for _, m := range co.Messages {
+		assert.Equal(t, plinko.CompileError, m.CompileMessage)
+		messages = append(messages, m.Message)
+	}
+
+	assert.Equal(t, []string{
+		"State 'Undefined' undefined: State 'Created' declares it as a superstate.",
+		"State 'Opened' is its own superstate: Opened -> Claimed -> Opened.",
+		"State 'Claimed' is its own superstate: Claimed -> Opened -> Claimed.",
+	}, messages)
+}
+
+func TestCompileInheritedTriggersAreNotDeadends(t *testing.T) {
+	p := createPlinkoDefinition()
+	p.InitialState(Opened)
+
+	p.Configure(Active).
+		Permit(Cancel, Canceled)
+
+	p.Configure(Opened).
+		SubstateOf(Active)
+
+	p.Configure(Canceled).
+		PermitReentry(Reinstate)
+
+	co := p.Compile()
+	assert.Empty(t, co.Messages)
+}
+
+func TestCompilePermitDynamicDestinations(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	selector := func(_ context.Context, _ plinko.Payload) (plinko.State, error) {
+		return Returned, nil
+	}
+
+	p.Configure(Delivered).
+		PermitDynamic(Return, selector, []plinko.State{Returned, "ReturnPending"}).
+		PermitDynamic(Cancel, selector, nil)
+
+	p.Configure(Returned).
+		PermitReentry(Return)
+
+	co := p.Compile()
+
+	assert.ElementsMatch(t, []plinko.CompilerMessage{
+		{CompileMessage: plinko.CompileError, Message: "State 'ReturnPending' undefined: Trigger 'Return' declares a transition to this undefined state.", Code: plinko.UndefinedStateCode},
+		{CompileMessage: plinko.CompileError, Message: "Trigger 'Cancel' declares a dynamic transition without any possible destination states.", Code: plinko.MissingDestinationsCode},
+		missingInitialState,
+	}, co.Messages)
+
+	var edges []plinko.State
+	p.(*PlinkoDefinition).Edges(func(state, destination plinko.State, trigger plinko.Trigger) {
+		if trigger == Return && state == Delivered {
+			edges = append(edges, destination)
+		}
+	})
+	assert.Equal(t, []plinko.State{Returned, "ReturnPending"}, edges)
+}
+
+var missingInitialState = plinko.CompilerMessage{
+	CompileMessage: plinko.CompileWarning,
+	Message:        "No initial state declared: reachability isn't analyzed.",
+	Code:           plinko.MissingInitialStateCode,
+}
+
+func messagesWithCode(messages []plinko.CompilerMessage, code plinko.CompilerMessageCode) []string {
+	var found []string
+	for _, m := range messages {
+		if m.Code == code {
+			found = append(found, m.Message)
+		}
+	}
+
+	return found
+}
+
+func TestCompileReachability(t *testing.T) {
+	p := createPlinkoDefinition()
+	p.InitialState(Created)
+
+	p.Configure(Active).
+		Permit(Cancel, Canceled)
+
+	p.Configure(Created).
+		SubstateOf(Active).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		Permit(Claim, Claimed)
+
+	// Claimed and Delivered can only go around in circles
+	p.Configure(Claimed).
+		Permit(Deliver, Delivered)
+
+	p.Configure(Delivered).
+		Permit(Return, Claimed)
+
+	// Returned only leads into the cycle, Refunded is never entered
+	p.Configure(Returned).
+		Permit(Reinstate, Claimed)
+
+	p.Configure(Refunded).
+		Permit(Reinstate, Opened)
+
+	p.Configure(Canceled)
+
+	co := p.Compile()
+
+	assert.Equal(t, []string{
+		"State 'Returned' can't be reached from the initial state 'Created'.",
+		"State 'Refunded' can't be reached from the initial state 'Created'.",
+	}, messagesWithCode(co.Messages, plinko.UnreachableStateCode))
+	assert.Equal(t, []string{
+		"States 'Claimed', 'Delivered' form a cycle that can't be left.",
+	}, messagesWithCode(co.Messages, plinko.InescapableComponentCode))
+	assert.Equal(t, []string{
+		"No terminal state can be reached from State 'Opened'.",
+	}, messagesWithCode(co.Messages, plinko.NoTerminalStateReachableCode))
+
+	for _, m := range co.Messages {
+		assert.Equal(t, plinko.CompileWarning, m.CompileMessage)
+	}
+}
+
+func TestCompileReachabilityNeedsInitialState(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		PermitReentry(Open)
+
+	p.Configure(Claimed)
+
+	assert.Equal(t, []plinko.CompilerMessage{missingInitialState}, p.Compile().Messages[1:])
+
+	p.InitialState(Delivered)
+	assert.Equal(t, []plinko.CompilerMessage{{
+		CompileMessage: plinko.CompileError,
+		Message:        "State 'Delivered' undefined: it is declared as the initial state.",
+		Code:           plinko.UndefinedInitialStateCode,
+	}}, p.Compile().Messages[1:])
+
+	assert.Panics(t, func() {
+		p.InitialState(Created)
+	})
+}
+
+func TestCompileCyclicMachineWithoutTerminalStates(t *testing.T) {
+	p := createPlinkoDefinition()
+	p.InitialState(Opened)
+
+	p.Configure(Opened).
+		Permit(Claim, Claimed)
+
+	p.Configure(Claimed).
+		Permit(Open, Opened).
+		PermitAuto(Opened)
+
+	assert.Empty(t, p.Compile().Messages)
+}
+
+func TestCompileUnusedTriggers(t *testing.T) {
+	p := createPlinkoDefinition()
+	p.InitialState(Created)
+
+	p.Configure(Created).
+		OnTriggerEntry(Reinstate, RecordState(nil)).
+		OnTriggerExit(Open, RecordState(nil)).
+		Ignore(Deliver).
+		Ignore(Reinstate).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		PermitReentry(Open)
+
+	co := p.Compile()
+
+	assert.Equal(t, []plinko.CompilerMessage{{
+		CompileMessage: plinko.CompileWarning,
+		Message:        "Trigger 'Reinstate' is referenced but not permitted by any state.",
+		Code:           plinko.UnusedTriggerCode,
+	}, {
+		CompileMessage: plinko.CompileWarning,
+		Message:        "Trigger 'Deliver' is referenced but not permitted by any state.",
+		Code:           plinko.UnusedTriggerCode,
+	}}, co.Messages)
+}
+
+func TestCompileTerminalStates(t *testing.T) {
+	p := createPlinkoDefinition()
+	p.InitialState(Created)
+
+	p.Configure(Created).
+		Permit(Open, Opened).
+		Permit(Cancel, Canceled)
+
+	// Opened is a dead end that isn't declared terminal
+	p.Configure(Opened)
+
+	p.Configure(Canceled).
+		Terminal()
+
+	p.Configure(Delivered).
+		Terminal().
+		Permit(Return, Returned)
+
+	p.Configure(Returned).
+		Terminal()
+
+	co := p.Compile()
+
+	assert.Equal(t, []plinko.CompilerMessage{{
+		CompileMessage: plinko.CompileWarning,
+		Message:        "State 'Opened' is a state without any triggers (deadend state).",
+		Code:           plinko.DeadEndStateCode,
+	}, {
+		CompileMessage: plinko.CompileWarning,
+		Message:        "State 'Delivered' is declared terminal but permits transitions.",
+		Code:           plinko.TerminalStateTransitionsCode,
+	}, {
+		CompileMessage: plinko.CompileWarning,
+		Message:        "State 'Delivered' can't be reached from the initial state 'Created'.",
+		Code:           plinko.UnreachableStateCode,
+	}, {
+		CompileMessage: plinko.CompileWarning,
+		Message:        "State 'Returned' can't be reached from the initial state 'Created'.",
+		Code:           plinko.UnreachableStateCode,
+	}, {
+		CompileMessage: plinko.CompileWarning,
+		Message:        "No terminal state can be reached from State 'Opened'.",
+		Code:           plinko.NoTerminalStateReachableCode,
+	}}, co.Messages)
+
+	var initial []plinko.State
+	p.(*PlinkoDefinition).Nodes(func(state plinko.State, info plinko.StateConfig) {
+		if info.Initial {
+			initial = append(initial, state)
+		}
+	})
+	assert.Equal(t, []plinko.State{Created}, initial)
+}
+
+func TestCompileStrict(t *testing.T) {
+	p := createPlinkoDefinition()
+	p.InitialState(Created)
+
+	p.Configure(Created).
+		Permit(Open, Opened).
+		Permit(Cancel, Canceled)
+
+	p.Configure(Opened)
+
+	psm, err := p.CompileStrict()
+
+	assert.Nil(t, psm)
+	var ce *plinkoerror.PlinkoCompileError
+	if assert.True(t, errors.As(err, &ce)) {
+		assert.Len(t, ce.Messages, 2)
+		assert.Equal(t, []plinko.CompilerMessage{{
+			CompileMessage: plinko.CompileError,
+			Message:        "State 'Canceled' undefined: Trigger 'Cancel' declares a transition to this undefined state.",
+			Code:           plinko.UndefinedStateCode,
+		}}, ce.Errors())
+	}
+
+	p.Configure(Canceled)
+
+	psm, err = p.CompileStrict()
+
+	assert.Nil(t, err)
+	assert.NotNil(t, psm)
+}
+
+const Submitted plinko.State = "Submitted"
+
+func TestCompiledMachineIsNotChangedByLaterConfiguration(t *testing.T) {
+	var steps []string
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	opened := p.Configure(Opened).
+		OnEntry(RecordStep(&steps, "enter opened"))
+
+	psm := p.Compile().StateMachine
+
+	opened.OnEntry(RecordStep(&steps, "added later")).
+		Permit(Claim, Claimed)
+	p.Configure(Submitted)
+	p.Use(func(next plinko.Operation, _ plinko.OperationInfo) plinko.Operation {
+		steps = append(steps, "intercepted")
+		return next
+	})
+	p.SideEffect(func(context.Context, plinko.StateAction, plinko.Payload, plinko.TransitionInfo, int64) {
+		steps = append(steps, "side effect")
+	})
+
+	_, err := psm.Fire(context.TODO(), &testPayload{state: Created}, Open)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"enter opened"}, steps)
+	assert.NotNil(t, psm.CanFire(context.TODO(), &testPayload{state: Opened}, Claim))
+	assert.NotNil(t, psm.CanFire(context.TODO(), &testPayload{state: Submitted}, Open))
+
+	// a new compile picks the changes up
+	steps = nil
+	_, err = p.Compile().StateMachine.Fire(context.TODO(), &testPayload{state: Created}, Open)
+
+	assert.Nil(t, err)
+	assert.Contains(t, steps, "added later")
+}
+
+func TestCompiledMachineIsSafeToShare(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		PermitReentry(Open)
+
+	psm := p.Compile().StateMachine
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := psm.Fire(context.TODO(), &testPayload{state: Opened}, Open)
+				assert.Nil(t, err)
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		p.Configure(plinko.State(fmt.Sprintf("State%d", i))).
+			Permit(Open, Opened)
+	}
+
+	wg.Wait()
+}
+
+func TestCompiledStatesPointAtTheCompiledDefinition(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		PermitReentry(Open)
+
+	psm := p.Compile().StateMachine.(plinkoStateMachine)
+
+	for _, sd := range psm.pd.Abs.StateDefinitions {
+		assert.True(t, sd.Abs == &psm.pd.Abs)
+	}
+}
+
+type triggerCountRule struct{}
+
+func (triggerCountRule) ID() plinko.CompilerMessageCode {
+	return "trigger-count"
+}
+
+func (triggerCountRule) Check(info plinko.StateInfo) []plinko.CompilerMessage {
+	return []plinko.CompilerMessage{{
+		CompileMessage: plinko.CompileWarning,
+		Message:        fmt.Sprintf("%s:%d", info.State, len(info.Permits)),
+		Code:           "ignored",
+	}}
+}
+
+func TestCompileLintRules(t *testing.T) {
+	p := createPlinkoDefinitionWithConfig(plinko.DefinitionConfig{
+		LintRules: []plinko.LintRule{triggerCountRule{}},
+	})
+	p.InitialState(Created)
+
+	p.Configure(Created).
+		Permit(Open, Opened).
+		PermitReentry(Cancel)
+
+	p.Configure(Opened, func(c *plinko.StateConfig) {
+		c.SuppressedRules = []plinko.CompilerMessageCode{"trigger-count"}
+	}).
+		Permit(Claim, Claimed)
+
+	p.Configure(Claimed).
+		Terminal()
+
+	co := p.Compile()
+
+	assert.Equal(t, []plinko.CompilerMessage{
+		{CompileMessage: plinko.CompileWarning, Message: "Created:2", Code: "trigger-count"},
+		{CompileMessage: plinko.CompileWarning, Message: "Claimed:0", Code: "trigger-count"},
+	}, co.Messages)
+}
+
+func TestCompileStateInfo(t *testing.T) {
+	var infos []plinko.StateInfo
+	p := createPlinkoDefinitionWithConfig(plinko.DefinitionConfig{
+		LintRules: []plinko.LintRule{captureRule{&infos}},
+	})
+
+	var steps []string
+	p.Configure(Created).
+		OnEntry(RecordStep(&steps, "enter created")).
+		OnError(RedirectTo(Canceled)).
+		PermitReentryIf(PermitIfPredicate, Open).
+		Permit(Submit, Submitted).
+		Ignore(Cancel)
+
+	p.Configure(Submitted)
+	p.Configure(Canceled)
+
+	p.Compile()
+
+	assert.Len(t, infos, 3)
+	info := infos[0]
+	assert.Equal(t, Created, info.State)
+	assert.Len(t, info.EntryOperations, 1)
+	assert.Len(t, info.ErrorOperations, 1)
+	assert.Equal(t, []plinko.Trigger{Cancel}, info.Ignored)
+	assert.Equal(t, []plinko.PermitInfo{
+		{Trigger: Open, Destinations: []plinko.State{Created}, Guarded: true, GuardName: info.Permits[0].GuardName, Reentry: true},
+		{Trigger: Submit, Destinations: []plinko.State{Submitted}},
+	}, info.Permits)
+}
+
+type captureRule struct {
+	infos *[]plinko.StateInfo
+}
+
+func (captureRule) ID() plinko.CompilerMessageCode {
+	return "capture"
+}
+
+func (r captureRule) Check(info plinko.StateInfo) []plinko.CompilerMessage {
+	*r.infos = append(*r.infos, info)
+	return nil
+}
+
+func TestCompileWarningsAsErrors(t *testing.T) {
+	p := createPlinkoDefinitionWithConfig(plinko.DefinitionConfig{WarningsAsErrors: true})
+	p.InitialState(Created)
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened)
+
+	psm, err := p.CompileStrict()
+
+	assert.Nil(t, psm)
+	var ce *plinkoerror.PlinkoCompileError
+	assert.True(t, errors.As(err, &ce))
+	assert.Equal(t, []plinko.CompilerMessage{{
+		CompileMessage: plinko.CompileError,
+		Message:        "State 'Opened' is a state without any triggers (deadend state).",
+		Code:           plinko.DeadEndStateCode,
+	}}, ce.Messages)
+}
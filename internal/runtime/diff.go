@@ -0,0 +1,379 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/shipt/plinko"
+)
+
+var chainKinds = []plinko.OperationKind{plinko.OnEntryOperation, plinko.OnExitOperation, plinko.OnErrorOperation}
+
+type permitKey struct {
+	state   plinko.State
+	trigger plinko.Trigger
+}
+
+type chainKey struct {
+	state plinko.State
+	kind  plinko.OperationKind
+}
+
+// snapshot is the structure of a definition in a canonical order, gathered through the plinko.Graph
+// enumeration.
+type snapshot struct {
+	states     []plinko.State
+	configs    map[plinko.State]plinko.StateConfig
+	permits    []permitKey
+	targets    map[permitKey][]plinko.State
+	guards     map[permitKey][]string
+	chains     map[chainKey][]string
+	internals  map[permitKey]string
+	ignored    map[plinko.State][]plinko.Trigger
+	triggers   []plinko.Trigger
+	parameters map[plinko.Trigger][]string
+}
+
+func takeSnapshot(g plinko.Graph) snapshot {
+	s := snapshot{
+		configs:    make(map[plinko.State]plinko.StateConfig),
+		targets:    make(map[permitKey][]plinko.State),
+		guards:     make(map[permitKey][]string),
+		chains:     make(map[chainKey][]string),
+		internals:  make(map[permitKey]string),
+		ignored:    make(map[plinko.State][]plinko.Trigger),
+		parameters: make(map[plinko.Trigger][]string),
+	}
+
+	g.Nodes(func(state plinko.State, cfg plinko.StateConfig) {
+		s.states = append(s.states, state)
+		s.configs[state] = cfg
+	})
+
+	g.Describe(func(info plinko.StateInfo) {
+		for _, permit := range info.Permits {
+			key := permitKey{info.State, permit.Trigger}
+			if _, ok := s.targets[key]; !ok {
+				s.permits = append(s.permits, key)
+				s.targets[key] = nil
+			}
+
+			// an internal transition has no destination, it's recorded as staying in its state
+			destinations := permit.Destinations
+			if permit.Internal {
+				destinations = []plinko.State{info.State}
+			}
+			for _, destination := range destinations {
+				if !findDestinationState(s.targets[key], destination) {
+					s.targets[key] = append(s.targets[key], destination)
+				}
+			}
+
+			if permit.GuardName != "" {
+				s.guards[key] = append(s.guards[key], permit.GuardName)
+			}
+			if permit.Internal {
+				s.internals[key] = permit.Operation.Name
+			}
+		}
+
+		if len(info.Ignored) > 0 {
+			s.ignored[info.State] = append([]plinko.Trigger(nil), info.Ignored...)
+		}
+
+		s.chains[chainKey{info.State, plinko.OnEntryOperation}] = operationNames(info.EntryOperations)
+		s.chains[chainKey{info.State, plinko.OnExitOperation}] = operationNames(info.ExitOperations)
+		s.chains[chainKey{info.State, plinko.OnErrorOperation}] = operationNames(info.ErrorOperations)
+	})
+
+	// trigger parameters aren't part of the graph, only the definitions of this package declare them
+	if pd, ok := g.(*PlinkoDefinition); ok {
+		for _, trigger := range pd.parameterizedTriggers() {
+			s.triggers = append(s.triggers, trigger)
+			s.parameters[trigger] = typeNames(pd.Parameters[trigger])
+		}
+	}
+
+	sortStates(s.states)
+	sortPermits(s.permits)
+	for _, triggers := range s.ignored {
+		sortTriggers(triggers)
+	}
+	for _, destinations := range s.targets {
+		sortStates(destinations)
+	}
+	for _, names := range s.guards {
+		sort.Strings(names)
+	}
+
+	return s
+}
+
+// fingerprint hashes the canonical text form of the snapshot.  The display names and descriptions of
+// states are left out since they don't change how the machine behaves.
+func (s snapshot) fingerprint() string {
+	var b strings.Builder
+
+	for _, state := range s.states {
+		cfg := s.configs[state]
+		fmt.Fprintf(&b, "state %q parent=%q initial=%t terminal=%t\n", state, cfg.Parent, cfg.Initial, cfg.Terminal)
+
+		for _, kind := range chainKinds {
+			if names := s.chains[chainKey{state, kind}]; len(names) > 0 {
+				fmt.Fprintf(&b, "chain %q %s %q\n", state, kind, names)
+			}
+		}
+
+		if triggers := s.ignored[state]; len(triggers) > 0 {
+			fmt.Fprintf(&b, "ignore %q %q\n", state, triggers)
+		}
+	}
+
+	for _, key := range s.permits {
+		fmt.Fprintf(&b, "permit %q %q -> %q guards=%q", key.state, key.trigger, s.targets[key], s.guards[key])
+		if name, ok := s.internals[key]; ok {
+			fmt.Fprintf(&b, " internal=%q", name)
+		}
+		b.WriteString("\n")
+	}
+
+	for _, trigger := range s.triggers {
+		fmt.Fprintf(&b, "parameters %q %q\n", trigger, s.parameters[trigger])
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// fingerprint returns the structural hash reported by Compile.
+func (pd PlinkoDefinition) fingerprint() string {
+	return takeSnapshot(&pd).fingerprint()
+}
+
+// Diff reports the structural changes needed to turn definition a into definition b.
+func Diff(a, b plinko.PlinkoDefinition) plinko.DefinitionDiff {
+	before, after := takeSnapshot(a), takeSnapshot(b)
+	var diff plinko.DefinitionDiff
+
+	for _, state := range after.states {
+		if !findDestinationState(before.states, state) {
+			diff.AddedStates = append(diff.AddedStates, state)
+		}
+	}
+	for _, state := range before.states {
+		if !findDestinationState(after.states, state) {
+			diff.RemovedStates = append(diff.RemovedStates, state)
+		}
+	}
+
+	permits := mergePermits(before.permits, after.permits)
+	for _, key := range permits {
+		change := plinko.TriggerChange{
+			State:        key.state,
+			Trigger:      key.trigger,
+			Before:       before.targets[key],
+			After:        after.targets[key],
+			GuardsBefore: before.guards[key],
+			GuardsAfter:  after.guards[key],
+		}
+
+		switch {
+		case len(change.Before) == 0:
+			diff.AddedTriggers = append(diff.AddedTriggers, change)
+		case len(change.After) == 0:
+			diff.RemovedTriggers = append(diff.RemovedTriggers, change)
+		case !equalStates(change.Before, change.After):
+			diff.RetargetedTriggers = append(diff.RetargetedTriggers, change)
+		case !equalStrings(change.GuardsBefore, change.GuardsAfter):
+			diff.ChangedGuards = append(diff.ChangedGuards, change)
+		}
+	}
+
+	for _, state := range mergeStates(before.states, after.states) {
+		for _, kind := range chainKinds {
+			key := chainKey{state, kind}
+			if !equalStrings(before.chains[key], after.chains[key]) {
+				diff.ChangedOperations = append(diff.ChangedOperations, plinko.OperationChange{
+					State:  state,
+					Kind:   kind,
+					Before: before.chains[key],
+					After:  after.chains[key],
+				})
+			}
+		}
+
+		for _, key := range permits {
+			if key.state != state {
+				continue
+			}
+			beforeOperation, afterOperation := internalOperation(before, key), internalOperation(after, key)
+			if !equalStrings(beforeOperation, afterOperation) {
+				diff.ChangedOperations = append(diff.ChangedOperations, plinko.OperationChange{
+					State:   state,
+					Kind:    plinko.InternalTransitionOperation,
+					Trigger: key.trigger,
+					Before:  beforeOperation,
+					After:   afterOperation,
+				})
+			}
+		}
+
+		if !equalTriggers(before.ignored[state], after.ignored[state]) {
+			diff.ChangedIgnores = append(diff.ChangedIgnores, plinko.IgnoreChange{
+				State:  state,
+				Before: before.ignored[state],
+				After:  after.ignored[state],
+			})
+		}
+	}
+
+	for _, trigger := range mergeTriggers(before.triggers, after.triggers) {
+		if !equalStrings(before.parameters[trigger], after.parameters[trigger]) {
+			diff.ChangedParameters = append(diff.ChangedParameters, plinko.ParameterChange{
+				Trigger: trigger,
+				Before:  before.parameters[trigger],
+				After:   after.parameters[trigger],
+			})
+		}
+	}
+
+	return diff
+}
+
+// internalOperation returns the operation name of an internal transition as a chain of one, nil when
+// the permit isn't an internal transition.
+func internalOperation(s snapshot, key permitKey) []string {
+	if name, ok := s.internals[key]; ok {
+		return []string{name}
+	}
+
+	return nil
+}
+
+func typeNames(types []reflect.Type) []string {
+	var names []string
+	for _, t := range types {
+		names = append(names, t.String())
+	}
+
+	return names
+}
+
+func operationNames(configs []plinko.OperationConfig) []string {
+	var names []string
+	for _, cfg := range configs {
+		if cfg.Trigger != "" {
+			names = append(names, fmt.Sprintf("%s [%s]", cfg.Name, cfg.Trigger))
+			continue
+		}
+		names = append(names, cfg.Name)
+	}
+
+	return names
+}
+
+func mergeStates(a, b []plinko.State) []plinko.State {
+	merged := append([]plinko.State{}, a...)
+	for _, state := range b {
+		if !findDestinationState(merged, state) {
+			merged = append(merged, state)
+		}
+	}
+	sortStates(merged)
+
+	return merged
+}
+
+func mergePermits(a, b []permitKey) []permitKey {
+	seen := make(map[permitKey]bool)
+	var merged []permitKey
+	for _, key := range append(append([]permitKey{}, a...), b...) {
+		if !seen[key] {
+			seen[key] = true
+			merged = append(merged, key)
+		}
+	}
+
+	sortPermits(merged)
+
+	return merged
+}
+
+func mergeTriggers(a, b []plinko.Trigger) []plinko.Trigger {
+	merged := append([]plinko.Trigger{}, a...)
+	for _, trigger := range b {
+		if !findTrigger(merged, trigger) {
+			merged = append(merged, trigger)
+		}
+	}
+	sortTriggers(merged)
+
+	return merged
+}
+
+func sortPermits(permits []permitKey) {
+	sort.Slice(permits, func(i, j int) bool {
+		if permits[i].state != permits[j].state {
+			return permits[i].state < permits[j].state
+		}
+		return permits[i].trigger < permits[j].trigger
+	})
+}
+
+func sortStates(states []plinko.State) {
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+}
+
+func sortTriggers(triggers []plinko.Trigger) {
+	sort.Slice(triggers, func(i, j int) bool { return triggers[i] < triggers[j] })
+}
+
+func equalTriggers(a, b []plinko.Trigger) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func equalStates(a, b []plinko.State) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
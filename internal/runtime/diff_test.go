@@ -0,0 +1,148 @@
+package runtime
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/pkg/config/operation"
+	"github.com/stretchr/testify/assert"
+)
+
+func notifyCustomer(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+	return p, nil
+}
+
+func auditOrder(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+	return p, nil
+}
+
+func orderIsPaid(_ context.Context, _ plinko.Payload, _ plinko.TransitionInfo) error {
+	return nil
+}
+
+func orderWorkflow(description string) plinko.PlinkoDefinition {
+	p := createPlinkoDefinition()
+
+	p.Configure(Created, func(c *plinko.StateConfig) { c.Description = description }).
+		OnExit(auditOrder).
+		Permit(Open, Opened).
+		Permit(Cancel, Canceled)
+
+	p.Configure(Opened).
+		OnEntry(notifyCustomer).
+		Permit(Cancel, Canceled)
+
+	p.Configure(Canceled)
+
+	return p
+}
+
+func TestFingerprintIsStable(t *testing.T) {
+	a := orderWorkflow("A new order.")
+	b := orderWorkflow("An order that was just placed.")
+
+	assert.NotEmpty(t, a.Compile().Fingerprint)
+	assert.Equal(t, a.Compile().Fingerprint, b.Compile().Fingerprint)
+	assert.True(t, Diff(a, b).Empty())
+
+	b.Configure(Claimed)
+	assert.NotEqual(t, a.Compile().Fingerprint, b.Compile().Fingerprint)
+}
+
+func TestDiff(t *testing.T) {
+	a := orderWorkflow("")
+
+	b := createPlinkoDefinition()
+
+	b.Configure(Created).
+		OnExit(auditOrder).
+		PermitIf(orderIsPaid, Open, Opened).
+		Permit(Cancel, Claimed)
+
+	b.Configure(Opened).
+		OnEntry(notifyCustomer).
+		OnEntry(auditOrder)
+
+	b.Configure(Claimed)
+
+	diff := Diff(a, b)
+
+	assert.Equal(t, []plinko.State{Claimed}, diff.AddedStates)
+	assert.Equal(t, []plinko.State{Canceled}, diff.RemovedStates)
+	assert.Empty(t, diff.AddedTriggers)
+	assert.Equal(t, []plinko.TriggerChange{
+		{State: Opened, Trigger: Cancel, Before: []plinko.State{Canceled}},
+	}, diff.RemovedTriggers)
+	assert.Equal(t, []plinko.TriggerChange{
+		{State: Created, Trigger: Cancel, Before: []plinko.State{Canceled}, After: []plinko.State{Claimed}},
+	}, diff.RetargetedTriggers)
+	assert.Equal(t, []plinko.TriggerChange{{
+		State:       Created,
+		Trigger:     Open,
+		Before:      []plinko.State{Opened},
+		After:       []plinko.State{Opened},
+		GuardsAfter: []string{"orderIsPaid"},
+	}}, diff.ChangedGuards)
+	assert.Equal(t, []plinko.OperationChange{{
+		State:  Opened,
+		Kind:   plinko.OnEntryOperation,
+		Before: []string{"notifyCustomer"},
+		After:  []string{"notifyCustomer", "auditOrder"},
+	}}, diff.ChangedOperations)
+}
+
+func TestDiffIgnoresInternalOperationsAndParameters(t *testing.T) {
+	a := orderWorkflow("")
+	a.TriggerParameters(AddItemToOrder, reflect.TypeOf(orderItem{}))
+	a.Configure(Claimed).
+		InternalTransition(AddItemToOrder, notifyCustomer, operation.WithName("NotifyCustomer"))
+
+	b := orderWorkflow("")
+	b.TriggerParameters(AddItemToOrder, reflect.TypeOf(orderItem{}), reflect.TypeOf(0))
+	b.Configure(Claimed).
+		InternalTransition(AddItemToOrder, auditOrder, operation.WithName("AuditOrder")).
+		Ignore(Open)
+
+	assert.NotEqual(t, a.Compile().Fingerprint, b.Compile().Fingerprint)
+
+	diff := Diff(a, b)
+
+	assert.Empty(t, diff.AddedTriggers)
+	assert.Empty(t, diff.RemovedTriggers)
+	assert.Equal(t, []plinko.OperationChange{{
+		State:   Claimed,
+		Kind:    plinko.InternalTransitionOperation,
+		Trigger: AddItemToOrder,
+		Before:  []string{"NotifyCustomer"},
+		After:   []string{"AuditOrder"},
+	}}, diff.ChangedOperations)
+	assert.Equal(t, []plinko.IgnoreChange{
+		{State: Claimed, After: []plinko.Trigger{Open}},
+	}, diff.ChangedIgnores)
+	assert.Equal(t, []plinko.ParameterChange{{
+		Trigger: AddItemToOrder,
+		Before:  []string{"runtime.orderItem"},
+		After:   []string{"runtime.orderItem", "int"},
+	}}, diff.ChangedParameters)
+	assert.False(t, diff.Empty())
+}
+
+func TestDiffTriggerOperations(t *testing.T) {
+	a := orderWorkflow("")
+	a.Configure(Claimed).
+		OnTriggerEntry(Open, auditOrder, operation.WithName("AuditOrder"))
+
+	b := orderWorkflow("")
+	b.Configure(Claimed).
+		OnTriggerEntry(Cancel, auditOrder, operation.WithName("AuditOrder"))
+
+	assert.NotEqual(t, a.Compile().Fingerprint, b.Compile().Fingerprint)
+	assert.Equal(t, []plinko.OperationChange{{
+		State:  Claimed,
+		Kind:   plinko.OnEntryOperation,
+		Before: []string{"AuditOrder [Open]"},
+		After:  []string{"AuditOrder [Cancel]"},
+	}}, Diff(a, b).ChangedOperations)
+}
@@ -0,0 +1,107 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package runtime
+
+import (
+	"reflect"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/internal/composition"
+	"github.com/shipt/plinko/internal/sideeffects"
+)
+
+// freeze returns a deep copy of the definition for a compiled state machine, so configuration made after
+// Compile doesn't change machines that are already running.  Operations, predicates and side effects are
+// shared, the tables that dispatch to them are not.
+func (pd PlinkoDefinition) freeze() *PlinkoDefinition {
+	// the frozen states keep pointers to its Abs and Interceptors, so it must not be copied once they exist
+	frozen := &PlinkoDefinition{}
+	*frozen = pd
+
+	frozen.SideEffects = append([]sideeffects.SideEffectDefinition(nil), pd.SideEffects...)
+	frozen.Interceptors = append([]plinko.Interceptor(nil), pd.Interceptors...)
+
+	if pd.Parameters != nil {
+		frozen.Parameters = make(map[plinko.Trigger][]reflect.Type, len(pd.Parameters))
+		for trigger, types := range pd.Parameters {
+			frozen.Parameters[trigger] = append([]reflect.Type(nil), types...)
+		}
+	}
+
+	frozen.Abs = AbstractSyntax{
+		States:             append([]plinko.State(nil), pd.Abs.States...),
+		TriggerDefinitions: make([]TriggerDefinition, 0, len(pd.Abs.TriggerDefinitions)),
+		TriggerReferences:  append([]plinko.Trigger(nil), pd.Abs.TriggerReferences...),
+	}
+	for _, td := range pd.Abs.TriggerDefinitions {
+		frozen.Abs.TriggerDefinitions = append(frozen.Abs.TriggerDefinitions, td.clone())
+	}
+
+	states := make(map[plinko.State]*InternalStateDefinition, len(*pd.States))
+	frozen.States = &states
+
+	// Abs.StateDefinitions keeps the declaration order the compiler and renderers rely on
+	for _, sd := range pd.Abs.StateDefinitions {
+		copied := sd.freeze(&frozen.Abs, &frozen.Interceptors)
+		states[copied.State] = copied
+		frozen.Abs.StateDefinitions = append(frozen.Abs.StateDefinitions, copied)
+	}
+
+	return frozen
+}
+
+func (sd *InternalStateDefinition) freeze(abs *AbstractSyntax, interceptors *[]plinko.Interceptor) *InternalStateDefinition {
+	info := *sd.info
+
+	triggers := make(map[plinko.Trigger][]*TriggerDefinition, len(sd.Triggers))
+	for trigger, permits := range sd.Triggers {
+		for _, td := range permits {
+			copied := td.clone()
+			triggers[trigger] = append(triggers[trigger], &copied)
+		}
+	}
+
+	ignored := make(map[plinko.Trigger]bool, len(sd.Ignored))
+	for trigger := range sd.Ignored {
+		ignored[trigger] = true
+	}
+
+	var autoTransitions []*TriggerDefinition
+	if sd.AutoTransitions != nil {
+		for _, td := range *sd.AutoTransitions {
+			copied := td.clone()
+			autoTransitions = append(autoTransitions, &copied)
+		}
+	}
+
+	callbacks := composition.CallbackDefinitions{
+		OnEntryFn:          append([]composition.ChainedFunctionCall(nil), sd.Callbacks.OnEntryFn...),
+		OnExitFn:           append([]composition.ChainedFunctionCall(nil), sd.Callbacks.OnExitFn...),
+		OnErrorFn:          append([]composition.ChainedErrorCall(nil), sd.Callbacks.OnErrorFn...),
+		EntryFunctionChain: append([]string(nil), sd.Callbacks.EntryFunctionChain...),
+		ExitFunctionChain:  append([]string(nil), sd.Callbacks.ExitFunctionChain...),
+		State:              sd.Callbacks.State,
+		Interceptors:       interceptors,
+	}
+
+	return &InternalStateDefinition{
+		State:           sd.State,
+		Triggers:        triggers,
+		Ignored:         ignored,
+		info:            &info,
+		AutoTransitions: &autoTransitions,
+		Callbacks:       &callbacks,
+		Abs:             abs,
+	}
+}
+
+func (td TriggerDefinition) clone() TriggerDefinition {
+	td.PossibleDestinations = append([]plinko.State(nil), td.PossibleDestinations...)
+	td.Internal = append([]composition.ChainedFunctionCall(nil), td.Internal...)
+
+	return td
+}
@@ -0,0 +1,168 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package runtime
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/internal/composition"
+	"github.com/shipt/plinko/internal/sideeffects"
+)
+
+// ancestry returns the state followed by each of its superstates, innermost first.  The walk stops at an
+// undefined or repeated superstate so a definition that failed to compile cannot loop forever.
+func (pd PlinkoDefinition) ancestry(state plinko.State) []*InternalStateDefinition {
+	var states []*InternalStateDefinition
+
+	for sd := (*pd.States)[state]; sd != nil; sd = (*pd.States)[sd.info.Parent] {
+		for _, visited := range states {
+			if visited == sd {
+				return states
+			}
+		}
+
+		states = append(states, sd)
+
+		if sd.info.Parent == "" {
+			break
+		}
+	}
+
+	return states
+}
+
+// findTrigger returns the permits for the trigger declared on the state, or failing that on the nearest
+// superstate that declares them, so a substate can override a trigger it would otherwise inherit.
+func (pd PlinkoDefinition) findTrigger(state plinko.State, trigger plinko.Trigger) []*TriggerDefinition {
+	for _, sd := range pd.ancestry(state) {
+		if permits, ok := sd.Triggers[trigger]; ok {
+			return permits
+		}
+	}
+
+	return nil
+}
+
+// isIgnored reports whether the trigger is ignored by the state or by the nearest superstate that
+// handles it; a permit declared on a nearer state takes precedence over an inherited Ignore.
+func (pd PlinkoDefinition) isIgnored(state plinko.State, trigger plinko.Trigger) bool {
+	for _, sd := range pd.ancestry(state) {
+		if _, ok := sd.Triggers[trigger]; ok {
+			return false
+		}
+
+		if sd.Ignored[trigger] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// declaredTriggers returns the triggers permitted in the state, its own in declaration order followed by
+// those inherited from its superstates.  Ignored triggers hide the permits of superstates.
+func (pd PlinkoDefinition) declaredTriggers(state plinko.State) []plinko.Trigger {
+	var triggers []plinko.Trigger
+	seen := make(map[plinko.Trigger]bool)
+
+	for _, sd := range pd.ancestry(state) {
+		for k := range sd.Ignored {
+			seen[k] = true
+		}
+
+		for _, td := range pd.Abs.TriggerDefinitions {
+			if td.Source != sd.State || seen[td.Name] || sd.Triggers[td.Name] == nil {
+				continue
+			}
+
+			seen[td.Name] = true
+			triggers = append(triggers, td.Name)
+		}
+	}
+
+	return triggers
+}
+
+// transitionPath returns the states exited, innermost first, and the states entered, outermost first,
+// when moving from source to destination.  Only the superstates below the least common ancestor of the
+// two states are crossed; a reentrant transition exits and enters the state itself.
+func (pd PlinkoDefinition) transitionPath(source, destination plinko.State) (exits, entries []*InternalStateDefinition) {
+	sourcePath := pd.ancestry(source)
+	destinationPath := pd.ancestry(destination)
+
+	var common *InternalStateDefinition
+	if len(sourcePath) > 1 && len(destinationPath) > 1 {
+	search:
+		for _, a := range sourcePath[1:] {
+			for _, b := range destinationPath[1:] {
+				if a == b {
+					common = a
+					break search
+				}
+			}
+		}
+	}
+
+	for _, sd := range sourcePath {
+		if sd == common {
+			break
+		}
+		exits = append(exits, sd)
+	}
+
+	for _, sd := range destinationPath {
+		if sd == common {
+			break
+		}
+		entries = append([]*InternalStateDefinition{sd}, entries...)
+	}
+
+	return exits, entries
+}
+
+// executeExitChains runs the exit chains of the states, recording the steps that complete in the journal
+// so the caller can compensate the whole transition when a step fails.
+func executeExitChains(ctx context.Context, states []*InternalStateDefinition, payload plinko.Payload, td plinko.TransitionInfo, journal *composition.Journal) (plinko.Payload, error) {
+	var err error
+	for _, sd := range states {
+		if payload, err = sd.Callbacks.RunExitChain(ctx, payload, td, journal); err != nil {
+			return payload, err
+		}
+	}
+
+	return payload, nil
+}
+
+// executeEntryChains runs the entry chains of the states, recording the steps that complete in the
+// journal so the caller can compensate the whole transition when a step fails.
+func executeEntryChains(ctx context.Context, states []*InternalStateDefinition, payload plinko.Payload, td plinko.TransitionInfo, journal *composition.Journal) (plinko.Payload, error) {
+	var err error
+	for _, sd := range states {
+		if payload, err = sd.Callbacks.RunEntryChain(ctx, payload, td, journal); err != nil {
+			return payload, err
+		}
+	}
+
+	return payload, nil
+}
+
+// executeErrorChains runs the error chain of the state and then those of its superstates, stopping at the
+// first handler that fails with an error of its own.
+func executeErrorChains(ctx context.Context, states []*InternalStateDefinition, payload plinko.Payload, td *sideeffects.TransitionDef, err error, elapsedMilliseconds int64) (plinko.Payload, *sideeffects.TransitionDef, error) {
+	errSub := err
+	for _, sd := range states {
+		payload, td, errSub = sd.Callbacks.ExecuteErrorChain(ctx, payload, td, err, elapsedMilliseconds)
+
+		if !errors.Is(errSub, err) {
+			break
+		}
+	}
+
+	return payload, td, errSub
+}
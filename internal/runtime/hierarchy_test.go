@@ -0,0 +1,237 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package runtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/pkg/config/operation"
+	"github.com/shipt/plinko/plinkoerror"
+	"github.com/stretchr/testify/assert"
+)
+
+const Active plinko.State = "Active"
+
+func RecordStep(steps *[]string, name string) plinko.Operation {
+	return func(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+		*steps = append(*steps, name)
+		return p, nil
+	}
+}
+
+func createHierarchicalDefinition(steps *[]string) plinko.PlinkoDefinition {
+	p := createPlinkoDefinition()
+
+	p.Configure(Active).
+		OnEntry(RecordStep(steps, "enter Active")).
+		OnExit(RecordStep(steps, "exit Active")).
+		Permit(Cancel, Canceled)
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		SubstateOf(Active).
+		OnEntry(RecordStep(steps, "enter Opened")).
+		OnExit(RecordStep(steps, "exit Opened")).
+		Permit(Claim, Claimed)
+
+	p.Configure(Claimed).
+		SubstateOf(Active).
+		OnEntry(RecordStep(steps, "enter Claimed")).
+		OnExit(RecordStep(steps, "exit Claimed")).
+		Permit(Submit, ArriveAtStore)
+
+	p.Configure(ArriveAtStore).
+		SubstateOf(Claimed).
+		OnEntry(RecordStep(steps, "enter ArrivedAtStore")).
+		OnExit(RecordStep(steps, "exit ArrivedAtStore"))
+
+	p.Configure(Canceled).
+		OnEntry(RecordStep(steps, "enter Canceled")).
+		Permit(Reinstate, Created)
+
+	return p
+}
+
+func TestTransitionPath(t *testing.T) {
+	var steps []string
+	pd := *createHierarchicalDefinition(&steps).(*PlinkoDefinition)
+
+	names := func(states []*InternalStateDefinition) []plinko.State {
+		var r []plinko.State
+		for _, sd := range states {
+			r = append(r, sd.State)
+		}
+		return r
+	}
+
+	exits, entries := pd.transitionPath(Opened, Claimed)
+	assert.Equal(t, []plinko.State{Opened}, names(exits))
+	assert.Equal(t, []plinko.State{Claimed}, names(entries))
+
+	exits, entries = pd.transitionPath(ArriveAtStore, Canceled)
+	assert.Equal(t, []plinko.State{ArriveAtStore, Claimed, Active}, names(exits))
+	assert.Equal(t, []plinko.State{Canceled}, names(entries))
+
+	exits, entries = pd.transitionPath(Created, ArriveAtStore)
+	assert.Equal(t, []plinko.State{Created}, names(exits))
+	assert.Equal(t, []plinko.State{Active, Claimed, ArriveAtStore}, names(entries))
+
+	exits, entries = pd.transitionPath(Opened, Opened)
+	assert.Equal(t, []plinko.State{Opened}, names(exits))
+	assert.Equal(t, []plinko.State{Opened}, names(entries))
+
+	exits, entries = pd.transitionPath(ArriveAtStore, Active)
+	assert.Equal(t, []plinko.State{ArriveAtStore, Claimed, Active}, names(exits))
+	assert.Equal(t, []plinko.State{Active}, names(entries))
+}
+
+func TestFireWithInheritedTrigger(t *testing.T) {
+	var steps []string
+	psm := createHierarchicalDefinition(&steps).Compile().StateMachine
+
+	payload := &mutablePayload{testPayload: testPayload{state: ArriveAtStore}}
+
+	assert.Nil(t, psm.CanFire(context.TODO(), payload, Cancel))
+
+	triggers, err := psm.EnumerateActiveTriggers(payload)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []plinko.Trigger{Submit, Cancel}, triggers)
+
+	pr, err := psm.Fire(context.TODO(), payload, Cancel)
+	assert.Nil(t, err)
+	assert.Equal(t, Canceled, pr.GetState())
+	assert.Equal(t, []string{"exit ArrivedAtStore", "exit Claimed", "exit Active", "enter Canceled"}, steps)
+}
+
+func TestFireBetweenSiblingSubstates(t *testing.T) {
+	var steps []string
+	psm := createHierarchicalDefinition(&steps).Compile().StateMachine
+
+	pr, err := psm.Fire(context.TODO(), &mutablePayload{testPayload: testPayload{state: Opened}}, Claim)
+	assert.Nil(t, err)
+	assert.Equal(t, Claimed, pr.GetState())
+	assert.Equal(t, []string{"exit Opened", "enter Claimed"}, steps)
+
+	steps = nil
+	_, err = psm.Fire(context.TODO(), &mutablePayload{testPayload: testPayload{state: Created}}, Open)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"enter Active", "enter Opened"}, steps)
+}
+
+func TestFireWithInheritedErrorHandler(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	handled := []plinko.State{}
+	recordError := func(state plinko.State) plinko.ErrorOperation {
+		return func(_ context.Context, p plinko.Payload, _ plinko.ModifiableTransitionInfo, _ error) (plinko.Payload, error) {
+			handled = append(handled, state)
+			return p, nil
+		}
+	}
+
+	p.Configure(Active).
+		OnError(recordError(Active))
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		SubstateOf(Active).
+		OnEntry(TransitionFn(true)).
+		OnError(recordError(Opened))
+
+	psm := p.Compile().StateMachine
+
+	_, err := psm.Fire(context.TODO(), &testPayload{state: Created}, Open)
+	assert.Equal(t, errors.New("error"), err)
+	assert.Equal(t, []plinko.State{Opened, Active}, handled)
+}
+
+func TestFireCompensatesEveryChainOfTheTransition(t *testing.T) {
+	var steps []string
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		OnExit(RecordStep(&steps, "leave Created"), operation.WithCompensation(RecordStep(&steps, "undo Created"))).
+		Permit(Open, Opened)
+
+	p.Configure(Active).
+		OnEntry(RecordStep(&steps, "enter Active"), operation.WithCompensation(RecordStep(&steps, "undo Active")))
+
+	p.Configure(Opened).
+		SubstateOf(Active).
+		OnEntry(RecordStep(&steps, "enter Opened"), operation.WithCompensation(RecordStep(&steps, "undo Opened"))).
+		OnEntry(TransitionFn(true)).
+		OnError(func(_ context.Context, p plinko.Payload, _ plinko.ModifiableTransitionInfo, _ error) (plinko.Payload, error) {
+			steps = append(steps, "handle error")
+			return p, nil
+		})
+
+	psm := p.Compile().StateMachine
+
+	_, err := psm.Fire(context.TODO(), &testPayload{state: Created}, Open)
+	assert.Equal(t, errors.New("error"), err)
+	assert.Equal(t, []string{
+		"leave Created", "enter Active", "enter Opened",
+		"handle error",
+		"undo Opened", "undo Active", "undo Created",
+	}, steps)
+}
+
+func TestFireKeepsExitStepsOfARedirectedTransition(t *testing.T) {
+	var steps []string
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		OnExit(RecordStep(&steps, "leave Created"), operation.WithCompensation(RecordStep(&steps, "undo Created"))).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		OnEntry(RecordStep(&steps, "enter Opened"), operation.WithCompensation(RecordStep(&steps, "undo Opened"))).
+		OnEntry(TransitionFn(true)).
+		OnError(RedirectTo(Canceled))
+
+	p.Configure(Canceled).
+		OnEntry(RecordStep(&steps, "enter Canceled"), operation.WithCompensation(RecordStep(&steps, "undo Canceled")))
+
+	psm := p.Compile().StateMachine
+
+	pr, err := psm.Fire(context.TODO(), &mutablePayload{testPayload: testPayload{state: Created}}, Open)
+
+	var re *plinkoerror.PlinkoRedirectError
+	assert.True(t, errors.As(err, &re))
+	assert.Equal(t, Canceled, pr.GetState())
+	// the payload still left Created, only the abandoned entry of Opened is undone
+	assert.Equal(t, []string{"leave Created", "enter Opened", "undo Opened", "enter Canceled"}, steps)
+}
+
+func TestSubstateRedeclarationPanic(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Active)
+	assert.Panics(t, func() {
+		p.Configure(Opened).
+			SubstateOf(Active).
+			SubstateOf(Created)
+	})
+}
+
+func TestAncestryStopsOnCycle(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Opened).SubstateOf(Claimed)
+	p.Configure(Claimed).SubstateOf(Opened)
+
+	pd := *p.(*PlinkoDefinition)
+	assert.Equal(t, 2, len(pd.ancestry(Opened)))
+	assert.Nil(t, pd.findTrigger(Opened, Cancel))
+}
@@ -11,21 +11,28 @@ import (
 	"fmt"
 	"reflect"
 	"runtime"
+	"runtime/debug"
 	"strings"
 
 	"github.com/shipt/plinko"
 	"github.com/shipt/plinko/internal/composition"
 	"github.com/shipt/plinko/internal/sideeffects"
+	"github.com/shipt/plinko/plinkoerror"
 )
 
 type plinkoStateMachine struct {
-	pd PlinkoDefinition
+	pd *PlinkoDefinition
 }
 
 type InternalStateDefinition struct {
 	State    plinko.State
-	Triggers map[plinko.Trigger]*TriggerDefinition
-	info     plinko.StateConfig
+	Triggers map[plinko.Trigger][]*TriggerDefinition
+	Ignored  map[plinko.Trigger]bool
+	info     *plinko.StateConfig
+
+	// AutoTransitions holds the completion transitions in declaration order; it is shared by pointer
+	// across the copies handed out by the fluent API.
+	AutoTransitions *[]*TriggerDefinition
 
 	Callbacks *composition.CallbackDefinitions
 
@@ -120,26 +127,28 @@ func (sd InternalStateDefinition) OnExit(exitFn plinko.Operation, opts ...plinko
 }
 
 func (sd InternalStateDefinition) OnTriggerEntry(trigger plinko.Trigger, entryFn plinko.Operation, opts ...plinko.OperationOption) plinko.StateDefinition {
+	sd.Abs.TriggerReferences = append(sd.Abs.TriggerReferences, trigger)
 	sd.Callbacks.AddEntry(func(_ context.Context, _ plinko.Payload, t plinko.TransitionInfo) error {
 		if t.GetTrigger() == trigger {
 			return nil
 		}
 
 		return fmt.Errorf("trigger '%s' not found for entry", trigger)
-	}, entryFn, newOperationConfig(entryFn, opts...))
+	}, entryFn, triggerOperationConfig(trigger, entryFn, opts...))
 
 	return sd
 
 }
 
 func (sd InternalStateDefinition) OnTriggerExit(trigger plinko.Trigger, exitFn plinko.Operation, opts ...plinko.OperationOption) plinko.StateDefinition {
+	sd.Abs.TriggerReferences = append(sd.Abs.TriggerReferences, trigger)
 	sd.Callbacks.AddExit(func(_ context.Context, _ plinko.Payload, t plinko.TransitionInfo) error {
 		if t.GetTrigger() == trigger {
 			return nil
 		}
 
 		return fmt.Errorf("trigger '%s' not found for exit", trigger)
-	}, exitFn, newOperationConfig(exitFn, opts...))
+	}, exitFn, triggerOperationConfig(trigger, exitFn, opts...))
 
 	return sd
 }
@@ -150,8 +159,8 @@ func (sd InternalStateDefinition) PermitReentry(trigger plinko.Trigger) plinko.S
 	return sd
 }
 
-func (sd InternalStateDefinition) PermitReentryIf(predicate plinko.Predicate, trigger plinko.Trigger) plinko.StateDefinition {
-	addPermit(&sd, trigger, sd.State, predicate)
+func (sd InternalStateDefinition) PermitReentryIf(predicate plinko.Predicate, trigger plinko.Trigger, opts ...plinko.OperationOption) plinko.StateDefinition {
+	addPermit(&sd, trigger, sd.State, predicate, opts...)
 
 	return sd
 }
@@ -162,8 +171,80 @@ func (sd InternalStateDefinition) Permit(trigger plinko.Trigger, destinationStat
 	return sd
 }
 
-func (sd InternalStateDefinition) PermitIf(predicate plinko.Predicate, trigger plinko.Trigger, destinationState plinko.State) plinko.StateDefinition {
-	addPermit(&sd, trigger, destinationState, predicate)
+// PermitIf permits the trigger when the guard passes.  Like PermitReentryIf and PermitAutoIf, it takes
+// options for the guard: operation.WithName names it in diagrams and errors, and a timeout, retry policy
+// or compensation, which a guard doesn't run, panics.
+func (sd InternalStateDefinition) PermitIf(predicate plinko.Predicate, trigger plinko.Trigger, destinationState plinko.State, opts ...plinko.OperationOption) plinko.StateDefinition {
+	addPermit(&sd, trigger, destinationState, predicate, opts...)
+
+	return sd
+}
+
+func (sd InternalStateDefinition) InternalTransition(trigger plinko.Trigger, operation plinko.Operation, opts ...plinko.OperationOption) plinko.StateDefinition {
+	addTriggerDefinition(&sd, TriggerDefinition{
+		Name:             trigger,
+		DestinationState: sd.State,
+		Internal: []composition.ChainedFunctionCall{{
+			Operation: operation,
+			Config:    newOperationConfig(operation, opts...),
+		}},
+	})
+
+	return sd
+}
+
+func (sd InternalStateDefinition) Ignore(trigger plinko.Trigger) plinko.StateDefinition {
+	reserveCompletionTrigger(trigger)
+
+	if _, ok := sd.Triggers[trigger]; ok || sd.Ignored[trigger] {
+		panic(fmt.Sprintf("Trigger: %s - has already been defined, plinko configuration invalid.", trigger))
+	}
+
+	sd.Ignored[trigger] = true
+	sd.Abs.TriggerReferences = append(sd.Abs.TriggerReferences, trigger)
+
+	return sd
+}
+
+func (sd InternalStateDefinition) PermitAuto(destinationState plinko.State) plinko.StateDefinition {
+	addAutoTransition(&sd, destinationState, nil)
+
+	return sd
+}
+
+func (sd InternalStateDefinition) PermitAutoIf(predicate plinko.Predicate, destinationState plinko.State, opts ...plinko.OperationOption) plinko.StateDefinition {
+	addAutoTransition(&sd, destinationState, predicate, opts...)
+
+	return sd
+}
+
+// PermitDynamic permits the trigger to the destination the selector returns when it fires.  Like PermitIf,
+// it takes options for the selector: operation.WithName names it in diagrams and documents, and a
+// timeout, retry policy or compensation panics.
+func (sd InternalStateDefinition) PermitDynamic(trigger plinko.Trigger, selector plinko.DestinationSelector, possibleDestinations []plinko.State, opts ...plinko.OperationOption) plinko.StateDefinition {
+	addTriggerDefinition(&sd, TriggerDefinition{
+		Name:                 trigger,
+		DestinationSelector:  selector,
+		SelectorConfig:       nameOnlyConfig("Selector", nameOf(selector), opts...),
+		PossibleDestinations: possibleDestinations,
+	})
+
+	return sd
+}
+
+func (sd InternalStateDefinition) SubstateOf(parent plinko.State) plinko.StateDefinition {
+	if sd.info.Parent != "" {
+		panic(fmt.Sprintf("State: %s - has already been declared a substate of %s, plinko configuration invalid.", sd.State, sd.info.Parent))
+	}
+
+	sd.info.Parent = parent
+
+	return sd
+}
+
+// Terminal declares the state an intended end of the machine, so Compile doesn't report it as a dead end.
+func (sd InternalStateDefinition) Terminal() plinko.StateDefinition {
+	sd.info.Terminal = true
 
 	return sd
 }
@@ -172,12 +253,22 @@ type AbstractSyntax struct {
 	States             []plinko.State
 	TriggerDefinitions []TriggerDefinition
 	StateDefinitions   []*InternalStateDefinition
+
+	// TriggerReferences lists the triggers named by OnTriggerEntry, OnTriggerExit and Ignore, which don't
+	// permit a transition themselves.
+	TriggerReferences []plinko.Trigger
 }
 
 type PlinkoDefinition struct {
 	States      *map[plinko.State]*InternalStateDefinition
 	SideEffects []sideeffects.SideEffectDefinition
 	Abs         AbstractSyntax
+	Config      plinko.DefinitionConfig
+	Parameters  map[plinko.Trigger][]reflect.Type
+
+	UnhandledTrigger plinko.UnhandledTriggerHandler
+	Interceptors     []plinko.Interceptor
+	Initial          plinko.State
 }
 
 func findDestinationState(states []plinko.State, searchState plinko.State) bool {
@@ -202,19 +293,68 @@ func (pd *PlinkoDefinition) FilteredSideEffect(filter plinko.SideEffectFilter, s
 	return pd
 }
 
+// OnUnhandledTrigger registers the handler called when a trigger is fired on a state that neither
+// permits nor ignores it, replacing any previously registered handler.
+func (pd *PlinkoDefinition) OnUnhandledTrigger(handler plinko.UnhandledTriggerHandler) plinko.PlinkoDefinition {
+	pd.UnhandledTrigger = handler
+
+	return pd
+}
+
+// Use registers interceptors that wrap every step of the entry, exit, error and internal transition
+// chains.  Interceptors run in the order they are registered, the first being the outermost.
+func (pd *PlinkoDefinition) Use(interceptors ...plinko.Interceptor) plinko.PlinkoDefinition {
+	pd.Interceptors = append(pd.Interceptors, interceptors...)
+
+	return pd
+}
+
+// InitialState declares the state payloads start in.  Compile uses it to find unreachable states and the
+// renderers draw the start marker pointing to it.
+func (pd *PlinkoDefinition) InitialState(state plinko.State) plinko.PlinkoDefinition {
+	if pd.Initial != "" {
+		panic(fmt.Sprintf("State: %s - has already been declared the initial state, plinko configuration invalid.", pd.Initial))
+	}
+
+	pd.Initial = state
+
+	return pd
+}
+
+func (pd *PlinkoDefinition) TriggerParameters(trigger plinko.Trigger, types ...reflect.Type) plinko.PlinkoDefinition {
+	if _, ok := pd.Parameters[trigger]; ok {
+		panic(fmt.Sprintf("Trigger: %s - parameters have already been defined, plinko configuration invalid.", trigger))
+	}
+
+	if pd.Parameters == nil {
+		pd.Parameters = make(map[plinko.Trigger][]reflect.Type)
+	}
+
+	pd.Parameters[trigger] = types
+
+	return pd
+}
+
 func (pd *PlinkoDefinition) Configure(state plinko.State, opts ...plinko.StateOption) plinko.StateDefinition {
 	if _, ok := (*pd.States)[state]; ok {
 		panic(fmt.Sprintf("State: %s - has already been defined, plinko configuration invalid.", state))
 	}
 
-	cbd := composition.CallbackDefinitions{}
+	cbd := composition.CallbackDefinitions{
+		State:        state,
+		Interceptors: &pd.Interceptors,
+	}
+	info := newStateConfig(state, opts...)
+	var autoTransitions []*TriggerDefinition
 
 	sd := InternalStateDefinition{
-		State:     state,
-		Triggers:  make(map[plinko.Trigger]*TriggerDefinition),
-		Abs:       &pd.Abs,
-		Callbacks: &cbd,
-		info:      newStateConfig(state, opts...),
+		State:           state,
+		Triggers:        make(map[plinko.Trigger][]*TriggerDefinition),
+		Ignored:         make(map[plinko.Trigger]bool),
+		AutoTransitions: &autoTransitions,
+		Abs:             &pd.Abs,
+		Callbacks:       &cbd,
+		info:            &info,
 	}
 
 	(*pd.States)[state] = &sd
@@ -226,30 +366,149 @@ func (pd *PlinkoDefinition) Configure(state plinko.State, opts ...plinko.StateOp
 }
 
 type TriggerDefinition struct {
+	Source           plinko.State
 	Name             plinko.Trigger
 	DestinationState plinko.State
 	Predicate        func(context.Context, plinko.Payload, plinko.TransitionInfo) error
+	// PredicateConfig names the guard when explaining why a trigger can't fire.
+	PredicateConfig plinko.OperationConfig
+
+	// DestinationSelector computes the destination at fire time for triggers declared with PermitDynamic,
+	// it must return one of PossibleDestinations.
+	DestinationSelector  plinko.DestinationSelector
+	SelectorConfig       plinko.OperationConfig
+	PossibleDestinations []plinko.State
+
+	// Internal holds the operation of an internal transition, which runs in place of the exit and entry
+	// chains and leaves the state unchanged.
+	Internal []composition.ChainedFunctionCall
+}
+
+// Destinations returns every state the trigger can transition to.
+func (td TriggerDefinition) Destinations() []plinko.State {
+	if td.DestinationSelector != nil {
+		return td.PossibleDestinations
+	}
+
+	return []plinko.State{td.DestinationState}
+}
+
+// resolveDestination returns the destination of the permit, running the selector of a dynamic permit.  A
+// selector that panics fails the trigger with a PlinkoPanicError.
+func (td TriggerDefinition) resolveDestination(ctx context.Context, payload plinko.Payload) (state plinko.State, err error) {
+	if td.DestinationSelector == nil {
+		return td.DestinationState, nil
+	}
+
+	defer func() {
+		if err1 := recover(); err1 != nil {
+			state = ""
+			err = plinkoerror.CreatePlinkoPanicError(err1, sideeffects.TransitionDef{Source: td.Source, Trigger: td.Name}, 0, td.SelectorConfig.Name, string(debug.Stack()))
+		}
+	}()
+
+	state, err = td.DestinationSelector(ctx, payload)
+	if err != nil {
+		return "", err
+	}
+
+	if !findDestinationState(td.PossibleDestinations, state) {
+		return "", plinkoerror.CreatePlinkoStateError(state, fmt.Sprintf("State '%s' is not a declared destination of dynamic trigger '%s'", state, td.Name))
+	}
+
+	return state, nil
 }
 
 type PlinkoDataStructure struct {
 	States map[plinko.State]plinko.StateDefinition
 }
 
-func addPermit(sd *InternalStateDefinition, trigger plinko.Trigger, destination plinko.State, predicate func(context.Context, plinko.Payload, plinko.TransitionInfo) error) {
-	if _, ok := sd.Triggers[trigger]; ok {
-		panic(fmt.Sprintf("Trigger: %s - has already been defined, plinko configuration invalid.", trigger))
+func addPermit(sd *InternalStateDefinition, trigger plinko.Trigger, destination plinko.State, predicate func(context.Context, plinko.Payload, plinko.TransitionInfo) error, opts ...plinko.OperationOption) {
+	addTriggerDefinition(sd, TriggerDefinition{
+		Name:             trigger,
+		DestinationState: destination,
+		Predicate:        predicate,
+		PredicateConfig:  newPredicateConfig(predicate, opts...),
+	})
+}
+
+// addTriggerDefinition registers a permit for the trigger.  A trigger may be permitted several times on
+// the same state as long as at most one of those permits is unguarded.
+func addTriggerDefinition(sd *InternalStateDefinition, td TriggerDefinition) {
+	reserveCompletionTrigger(td.Name)
+
+	if sd.Ignored[td.Name] {
+		panic(fmt.Sprintf("Trigger: %s - has already been defined as ignored, plinko configuration invalid.", td.Name))
+	}
+
+	if td.Predicate == nil {
+		for _, existing := range sd.Triggers[td.Name] {
+			if existing.Predicate == nil {
+				panic(fmt.Sprintf("Trigger: %s - has already been defined, plinko configuration invalid.", td.Name))
+			}
+		}
+	}
+
+	td.Source = sd.State
+	sd.Triggers[td.Name] = append(sd.Triggers[td.Name], &td)
+	sd.Abs.TriggerDefinitions = append(sd.Abs.TriggerDefinitions, td)
+}
+
+// reserveCompletionTrigger keeps plinko.CompletionTrigger for the transitions declared with PermitAuto and
+// PermitAutoIf, which are told apart from permits by that name.
+func reserveCompletionTrigger(trigger plinko.Trigger) {
+	if trigger == plinko.CompletionTrigger {
+		panic(fmt.Sprintf("Trigger: %s - is reserved for automatic transitions, plinko configuration invalid.", trigger))
 	}
+}
 
+func addAutoTransition(sd *InternalStateDefinition, destination plinko.State, predicate plinko.Predicate, opts ...plinko.OperationOption) {
 	td := TriggerDefinition{
-		Name:             trigger,
+		Source:           sd.State,
+		Name:             plinko.CompletionTrigger,
 		DestinationState: destination,
 		Predicate:        predicate,
+		PredicateConfig:  newPredicateConfig(predicate, opts...),
 	}
 
-	sd.Triggers[trigger] = &td
+	if predicate == nil {
+		for _, existing := range *sd.AutoTransitions {
+			if existing.Predicate == nil {
+				panic(fmt.Sprintf("State: %s - already declares an unguarded automatic transition, plinko configuration invalid.", sd.State))
+			}
+		}
+	}
+
+	*sd.AutoTransitions = append(*sd.AutoTransitions, &td)
 	sd.Abs.TriggerDefinitions = append(sd.Abs.TriggerDefinitions, td)
 }
 
+func newPredicateConfig(predicate plinko.Predicate, opts ...plinko.OperationOption) plinko.OperationConfig {
+	if predicate == nil {
+		return plinko.OperationConfig{}
+	}
+
+	return nameOnlyConfig("Guard", nameOf(predicate), opts...)
+}
+
+// nameOnlyConfig applies the options of a guard or selector, which the chains don't run, so only its name
+// can be set.
+func nameOnlyConfig(kind string, name string, opts ...plinko.OperationOption) plinko.OperationConfig {
+	c := plinko.OperationConfig{
+		Name: name,
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	if c.Timeout != 0 || c.Retry != nil || c.Compensation != nil {
+		panic(fmt.Sprintf("%s: %s - only takes a name, plinko configuration invalid.", kind, c.Name))
+	}
+
+	return c
+}
+
 func newOperationConfig(op interface{}, opts ...plinko.OperationOption) plinko.OperationConfig {
 	c := plinko.OperationConfig{
 		Name: getFunctionName(op),
@@ -262,6 +521,14 @@ func newOperationConfig(op interface{}, opts ...plinko.OperationOption) plinko.O
 	return c
 }
 
+// triggerOperationConfig describes an operation that only runs on transitions fired by the trigger.
+func triggerOperationConfig(trigger plinko.Trigger, op plinko.Operation, opts ...plinko.OperationOption) plinko.OperationConfig {
+	c := newOperationConfig(op, opts...)
+	c.Trigger = trigger
+
+	return c
+}
+
 func getFunctionName(i interface{}) string {
 	return runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
 }
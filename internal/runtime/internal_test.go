@@ -32,7 +32,7 @@ func TestGetCallerHelper(t *testing.T) {
 func TestStateDefinition(t *testing.T) {
 	state := InternalStateDefinition{
 		State:    "NewOrder",
-		Triggers: make(map[plinko.Trigger]*TriggerDefinition),
+		Triggers: make(map[plinko.Trigger][]*TriggerDefinition),
 	}
 
 	assert.Panics(t, func() {
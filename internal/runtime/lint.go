@@ -0,0 +1,133 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package runtime
+
+import (
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/internal/composition"
+)
+
+// lint runs the configured lint rules over every state that doesn't suppress them.
+func (pd PlinkoDefinition) lint() []plinko.CompilerMessage {
+	var messages []plinko.CompilerMessage
+
+	for _, sd := range pd.Abs.StateDefinitions {
+		info := pd.stateInfo(sd)
+
+		for _, rule := range pd.Config.LintRules {
+			if suppressed(info.Config, rule.ID()) {
+				continue
+			}
+
+			for _, m := range rule.Check(info) {
+				m.Code = rule.ID()
+				messages = append(messages, m)
+			}
+		}
+	}
+
+	return messages
+}
+
+func suppressed(cfg plinko.StateConfig, id plinko.CompilerMessageCode) bool {
+	for _, suppressedID := range cfg.SuppressedRules {
+		if suppressedID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// promoteWarnings reports the warnings as errors when the definition is configured to.
+func (pd PlinkoDefinition) promoteWarnings(messages []plinko.CompilerMessage) []plinko.CompilerMessage {
+	if !pd.Config.WarningsAsErrors {
+		return messages
+	}
+
+	for i := range messages {
+		if messages[i].CompileMessage == plinko.CompileWarning {
+			messages[i].CompileMessage = plinko.CompileError
+		}
+	}
+
+	return messages
+}
+
+func (pd PlinkoDefinition) stateInfo(sd *InternalStateDefinition) plinko.StateInfo {
+	info := plinko.StateInfo{
+		State:           sd.State,
+		Config:          *sd.info,
+		EntryOperations: operationConfigs(sd.Callbacks.OnEntryFn),
+		ExitOperations:  operationConfigs(sd.Callbacks.OnExitFn),
+	}
+	info.Config.Initial = sd.State == pd.Initial
+
+	for _, fn := range sd.Callbacks.OnErrorFn {
+		info.ErrorOperations = append(info.ErrorOperations, fn.Config)
+	}
+
+	for _, ancestor := range pd.ancestry(sd.State) {
+		if ancestor == sd {
+			continue
+		}
+		for _, fn := range ancestor.Callbacks.OnErrorFn {
+			info.InheritedErrorOperations = append(info.InheritedErrorOperations, fn.Config)
+		}
+	}
+
+	for _, td := range pd.Abs.TriggerDefinitions {
+		if td.Source != sd.State {
+			continue
+		}
+
+		permit := plinko.PermitInfo{
+			Trigger:      td.Name,
+			Destinations: td.Destinations(),
+			Guarded:      td.Predicate != nil,
+			GuardName:    td.PredicateConfig.Name,
+			Reentry:      td.DestinationSelector == nil && td.Internal == nil && td.DestinationState == sd.State,
+			Dynamic:      td.DestinationSelector != nil,
+			SelectorName: td.SelectorConfig.Name,
+			Internal:     td.Internal != nil,
+			Automatic:    td.Name == plinko.CompletionTrigger,
+		}
+		if len(td.Internal) > 0 {
+			permit.Destinations = nil
+			permit.Operation = td.Internal[0].Config
+		}
+
+		info.Permits = append(info.Permits, permit)
+	}
+
+	for _, sdi := range pd.Abs.TriggerReferences {
+		if sd.Ignored[sdi] && !findTrigger(info.Ignored, sdi) {
+			info.Ignored = append(info.Ignored, sdi)
+		}
+	}
+
+	return info
+}
+
+func operationConfigs(funcs []composition.ChainedFunctionCall) []plinko.OperationConfig {
+	var configs []plinko.OperationConfig
+	for _, fn := range funcs {
+		configs = append(configs, fn.Config)
+	}
+
+	return configs
+}
+
+func findTrigger(triggers []plinko.Trigger, trigger plinko.Trigger) bool {
+	for _, t := range triggers {
+		if t == trigger {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,46 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package runtime
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/plinkoerror"
+)
+
+// validateArgs checks the arguments supplied when firing a trigger against the parameters declared for
+// it with TriggerParameters.  Triggers without declared parameters accept no arguments.
+func (pd PlinkoDefinition) validateArgs(trigger plinko.Trigger, args []interface{}) error {
+	types := pd.Parameters[trigger]
+
+	if len(args) != len(types) {
+		return plinkoerror.CreatePlinkoTriggerError(trigger, fmt.Sprintf("Trigger '%s' expects %d argument(s), %d supplied", trigger, len(types), len(args)))
+	}
+
+	for i, arg := range args {
+		if !isAssignable(arg, types[i]) {
+			return plinkoerror.CreatePlinkoTriggerError(trigger, fmt.Sprintf("Trigger '%s' argument %d is %T, expected %s", trigger, i, arg, types[i]))
+		}
+	}
+
+	return nil
+}
+
+func isAssignable(arg interface{}, t reflect.Type) bool {
+	if arg == nil {
+		switch t.Kind() {
+		case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice:
+			return true
+		}
+
+		return false
+	}
+
+	return reflect.TypeOf(arg).AssignableTo(t)
+}
@@ -0,0 +1,139 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package runtime
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/plinkoerror"
+	"github.com/stretchr/testify/assert"
+)
+
+const AddItemToOrder plinko.Trigger = "AddItemToOrder"
+
+type orderItem struct {
+	sku      string
+	quantity int
+}
+
+func TestValidateArgs(t *testing.T) {
+	p := createPlinkoDefinition()
+	p.TriggerParameters(AddItemToOrder, reflect.TypeOf(orderItem{}), reflect.TypeOf((*error)(nil)).Elem())
+
+	pd := *p.(*PlinkoDefinition)
+
+	assert.Nil(t, pd.validateArgs(AddItemToOrder, []interface{}{orderItem{}, errors.New("reason")}))
+	assert.Nil(t, pd.validateArgs(AddItemToOrder, []interface{}{orderItem{}, nil}))
+	assert.Nil(t, pd.validateArgs(Open, nil))
+
+	err := pd.validateArgs(AddItemToOrder, []interface{}{orderItem{}})
+	assert.Equal(t, "Trigger 'AddItemToOrder' expects 2 argument(s), 1 supplied", err.Error())
+
+	err = pd.validateArgs(AddItemToOrder, []interface{}{"sku", nil})
+	assert.Equal(t, "Trigger 'AddItemToOrder' argument 0 is string, expected runtime.orderItem", err.Error())
+
+	err = pd.validateArgs(Open, []interface{}{"unexpected"})
+	var pte *plinkoerror.PlinkoTriggerError
+	assert.True(t, errors.As(err, &pte))
+	assert.Equal(t, Open, pte.Trigger)
+}
+
+func TestTriggerParametersRedeclarationPanic(t *testing.T) {
+	p := createPlinkoDefinition()
+	p.TriggerParameters(AddItemToOrder, reflect.TypeOf(""))
+
+	assert.Panics(t, func() { p.TriggerParameters(AddItemToOrder, reflect.TypeOf(0)) })
+}
+
+func TestFireWithArgs(t *testing.T) {
+	p := createPlinkoDefinition()
+	p.TriggerParameters(AddItemToOrder, reflect.TypeOf(orderItem{}))
+
+	var operationItem, sideEffectItem interface{}
+	p.Configure(Opened).
+		PermitReentryIf(func(_ context.Context, _ plinko.Payload, ti plinko.TransitionInfo) error {
+			if ti.GetArgs()[0].(orderItem).quantity > 0 {
+				return nil
+			}
+			return errors.New("quantity required")
+		}, AddItemToOrder).
+		OnEntry(func(_ context.Context, p plinko.Payload, ti plinko.TransitionInfo) (plinko.Payload, error) {
+			operationItem = ti.GetArgs()[0]
+			return p, nil
+		})
+
+	p.FilteredSideEffect(plinko.AllowAfterTransition, func(_ context.Context, _ plinko.StateAction, _ plinko.Payload, ti plinko.TransitionInfo, _ int64) {
+		sideEffectItem = ti.GetArgs()[0]
+	})
+
+	psm := p.Compile().StateMachine
+	payload := &testPayload{state: Opened}
+
+	item := orderItem{sku: "banana", quantity: 2}
+	_, err := psm.FireWithArgs(context.TODO(), payload, AddItemToOrder, item)
+	assert.Nil(t, err)
+	assert.Equal(t, item, operationItem)
+	assert.Equal(t, item, sideEffectItem)
+
+	_, err = psm.FireWithArgs(context.TODO(), payload, AddItemToOrder, orderItem{sku: "banana"})
+	assert.NotNil(t, err)
+
+	_, err = psm.Fire(context.TODO(), payload, AddItemToOrder)
+	assert.Equal(t, "Trigger 'AddItemToOrder' expects 1 argument(s), 0 supplied", err.Error())
+}
+
+func TestGuardReadingArgsWithoutArgs(t *testing.T) {
+	p := createPlinkoDefinition()
+	p.TriggerParameters(AddItemToOrder, reflect.TypeOf(orderItem{}))
+
+	p.Configure(Opened).
+		PermitReentryIf(func(_ context.Context, _ plinko.Payload, ti plinko.TransitionInfo) error {
+			if ti.GetArgs()[0].(orderItem).quantity > 0 {
+				return nil
+			}
+			return errors.New("quantity required")
+		}, AddItemToOrder)
+
+	psm := p.Compile().StateMachine
+	payload := &testPayload{state: Opened}
+
+	// guards are evaluated without arguments outside FireWithArgs, so the guard's panic fails it
+	var ppe *plinkoerror.PlinkoPanicError
+	assert.True(t, errors.As(psm.CanFire(context.TODO(), payload, AddItemToOrder), &ppe))
+
+	explanation := psm.Explain(context.TODO(), payload, AddItemToOrder)
+	if assert.Len(t, explanation.Guards, 1) {
+		assert.False(t, explanation.Guards[0].Passed)
+		assert.True(t, errors.As(explanation.Guards[0].Err, &ppe))
+	}
+
+	statuses, err := psm.EnumerateActiveTriggersContext(context.TODO(), payload, true)
+	assert.Nil(t, err)
+	if assert.Len(t, statuses, 1) {
+		assert.False(t, statuses[0].Enabled)
+	}
+}
+
+func TestCompileUnusedTriggerParameters(t *testing.T) {
+	p := createPlinkoDefinition()
+	p.InitialState(Opened)
+	p.TriggerParameters(AddItemToOrder, reflect.TypeOf(orderItem{}))
+
+	p.Configure(Opened).
+		PermitReentry(Open)
+
+	co := p.Compile()
+	assert.Equal(t, []plinko.CompilerMessage{{
+		CompileMessage: plinko.CompileWarning,
+		Message:        "Trigger 'AddItemToOrder' declares parameters but is not permitted by any state.",
+		Code:           plinko.UnusedTriggerParametersCode,
+	}}, co.Messages)
+}
@@ -8,10 +8,13 @@ package runtime
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime/debug"
 	"time"
 
 	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/internal/composition"
 	"github.com/shipt/plinko/internal/sideeffects"
 	"github.com/shipt/plinko/plinkoerror"
 )
@@ -24,104 +27,434 @@ func (psm plinkoStateMachine) EnumerateActiveTriggers(payload plinko.Payload) ([
 		return nil, plinkoerror.CreatePlinkoStateError(state, fmt.Sprintf("State %s not found in state machine definition", state))
 	}
 
-	keys := make([]plinko.Trigger, 0, len(sd2.Triggers))
-	for k := range sd2.Triggers {
-		keys = append(keys, k)
+	return psm.pd.declaredTriggers(state), nil
+
+}
+
+// EnumerateActiveTriggersContext evaluates the guards of the triggers permitted in the payload's state and
+// returns them in declaration order.  Only the triggers that can be fired are returned unless includeBlocked
+// is set, in which case the blocked triggers are returned as well with the error CanFire would report.
+func (psm plinkoStateMachine) EnumerateActiveTriggersContext(ctx context.Context, payload plinko.Payload, includeBlocked bool) ([]plinko.TriggerStatus, error) {
+	state := payload.GetState()
+
+	if err := ctx.Err(); err != nil {
+		return nil, plinkoerror.CreatePlinkoContextError(err, sideeffects.TransitionDef{Source: state}, 0, "")
 	}
 
-	return keys, nil
+	sd2 := (*psm.pd.States)[state]
+
+	if sd2 == nil {
+		return nil, plinkoerror.CreatePlinkoStateError(state, fmt.Sprintf("State %s not found in state machine definition", state))
+	}
 
+	var statuses []plinko.TriggerStatus
+	for _, trigger := range psm.pd.declaredTriggers(state) {
+		permits := psm.pd.findTrigger(state, trigger)
+		_, err := selectPermit(state, trigger, permits, evaluateGuards(ctx, payload, state, trigger, permits, nil))
+
+		if err != nil && !includeBlocked {
+			continue
+		}
+
+		statuses = append(statuses, plinko.TriggerStatus{
+			Trigger: trigger,
+			Enabled: err == nil,
+			Err:     err,
+		})
+	}
+
+	return statuses, nil
 }
 
 func (psm plinkoStateMachine) CanFire(ctx context.Context, payload plinko.Payload, trigger plinko.Trigger) error {
+	return psm.Explain(ctx, payload, trigger).Err
+}
+
+// Explain evaluates the trigger for the payload the way CanFire does, reporting each step of the
+// evaluation rather than only the resulting error.
+func (psm plinkoStateMachine) Explain(ctx context.Context, payload plinko.Payload, trigger plinko.Trigger) plinko.Explanation {
 	state := payload.GetState()
-	sd2 := (*psm.pd.States)[state]
+	explanation := plinko.Explanation{
+		State:   state,
+		Trigger: trigger,
+	}
 
-	if sd2 == nil {
-		return plinkoerror.CreatePlinkoStateError(state, fmt.Sprintf("State '%s' not defined", state))
+	if (*psm.pd.States)[state] == nil {
+		explanation.Err = plinkoerror.CreatePlinkoStateError(state, fmt.Sprintf("State '%s' not defined", state))
+		return explanation
 	}
+	explanation.StateFound = true
 
-	triggerData := sd2.Triggers[trigger]
-	if triggerData == nil {
-		return plinkoerror.CreatePlinkoTriggerError(trigger, fmt.Sprintf("Triggers '%s' not defined for state '%s'", trigger, state))
+	if psm.pd.isIgnored(state, trigger) {
+		explanation.TriggerDefined = true
+		explanation.Ignored = true
+		return explanation
 	}
 
-	if triggerData.Predicate != nil {
-		return triggerData.Predicate(ctx, payload, sideeffects.TransitionDef{
-			Destination: triggerData.DestinationState,
-			Source:      state,
-			Trigger:     triggerData.Name,
-		})
+	permits := psm.pd.findTrigger(state, trigger)
+	if permits == nil {
+		explanation.Err = plinkoerror.CreatePlinkoTriggerError(trigger, fmt.Sprintf("Triggers '%s' not defined for state '%s'", trigger, state))
+		return explanation
+	}
+	explanation.TriggerDefined = true
+
+	explanation.Guards = evaluateGuards(ctx, payload, state, trigger, permits, nil)
+	_, explanation.Err = selectPermit(state, trigger, permits, explanation.Guards)
+
+	return explanation
+}
+
+// evaluateGuards runs the guards of the trigger's permits in declaration order.
+func evaluateGuards(ctx context.Context, payload plinko.Payload, state plinko.State, trigger plinko.Trigger, permits []*TriggerDefinition, args []interface{}) []plinko.GuardResult {
+	results := make([]plinko.GuardResult, 0, len(permits))
+
+	for _, td := range permits {
+		result := plinko.GuardResult{
+			Destinations: td.Destinations(),
+			GuardName:    td.PredicateConfig.Name,
+			Passed:       true,
+		}
+
+		if td.Predicate != nil {
+			result.Err = td.checkGuard(ctx, payload, sideeffects.TransitionDef{
+				Source:      state,
+				Destination: td.DestinationState,
+				Trigger:     trigger,
+				Args:        args,
+			})
+			result.Passed = result.Err == nil
+		}
+
+		results = append(results, result)
 	}
 
-	return nil
+	return results
+}
+
+// checkGuard runs the permit's guard, turning a panic into a PlinkoPanicError that fails the guard.  CanFire,
+// Explain and EnumerateActiveTriggersContext evaluate guards without arguments, so a guard reading GetArgs
+// that doesn't check their length fails there rather than crashing the caller.
+func (td TriggerDefinition) checkGuard(ctx context.Context, payload plinko.Payload, t sideeffects.TransitionDef) (err error) {
+	defer func() {
+		if err1 := recover(); err1 != nil {
+			err = plinkoerror.CreatePlinkoPanicError(err1, t, 0, td.PredicateConfig.Name, string(debug.Stack()))
+		}
+	}()
+
+	return td.Predicate(ctx, payload, t)
+}
+
+// selectPermit returns the one guarded permit whose guard passed, or the unguarded permit when no guard
+// passed.  When the trigger has a single permit, a failing guard's own error is returned; otherwise a
+// PlinkoGuardError reports that no guard passed without a fallback, or that several guards passed.
+func selectPermit(state plinko.State, trigger plinko.Trigger, permits []*TriggerDefinition, results []plinko.GuardResult) (*TriggerDefinition, error) {
+	if len(permits) == 1 {
+		if !results[0].Passed {
+			return nil, results[0].Err
+		}
+		return permits[0], nil
+	}
+
+	var selected []*TriggerDefinition
+	var destinations []plinko.State
+	var causes []error
+	var fallback *TriggerDefinition
+
+	for i, td := range permits {
+		switch {
+		case td.Predicate == nil:
+			fallback = td
+		case results[i].Passed:
+			selected = append(selected, td)
+			destinations = append(destinations, td.DestinationState)
+		default:
+			causes = append(causes, results[i].Err)
+		}
+	}
+
+	switch {
+	case len(selected) == 1:
+		return selected[0], nil
+	case len(selected) == 0 && fallback != nil:
+		return fallback, nil
+	case len(selected) == 0:
+		return nil, plinkoerror.WrapPlinkoGuardError(trigger, state, causes, fmt.Sprintf("No guard passed for Trigger '%s' in state: %s", trigger, state))
+	}
+
+	return nil, plinkoerror.CreatePlinkoGuardError(trigger, state, destinations, fmt.Sprintf("Guards for %d permits of Trigger '%s' passed in state: %s", len(selected), trigger, state))
 }
 
 func (psm plinkoStateMachine) Fire(ctx context.Context, payload plinko.Payload, trigger plinko.Trigger) (plinko.Payload, error) {
+	return psm.FireWithArgs(ctx, payload, trigger)
+}
+
+func (psm plinkoStateMachine) FireWithArgs(ctx context.Context, payload plinko.Payload, trigger plinko.Trigger, args ...interface{}) (plinko.Payload, error) {
 	start := time.Now()
+
 	state := payload.GetState()
+
+	if err := ctx.Err(); err != nil {
+		return payload, plinkoerror.CreatePlinkoContextError(err, sideeffects.TransitionDef{Source: state, Trigger: trigger, Args: args}, 0, "")
+	}
+
 	sd2 := (*psm.pd.States)[state]
 
 	if sd2 == nil {
 		return payload, plinkoerror.CreatePlinkoStateError(state, fmt.Sprintf("State not found in definition of states: %s", state))
 	}
 
-	triggerData := sd2.Triggers[trigger]
+	if psm.pd.isIgnored(state, trigger) {
+		return payload, nil
+	}
+
+	permits := psm.pd.findTrigger(state, trigger)
+
+	if permits == nil {
+		if psm.pd.UnhandledTrigger != nil {
+			return payload, psm.pd.UnhandledTrigger(ctx, payload, trigger)
+		}
 
-	if triggerData == nil {
 		return payload, plinkoerror.CreatePlinkoTriggerError(trigger, fmt.Sprintf("Trigger '%s' not found in definition for state: %s", trigger, state))
 	}
 
-	destinationState := (*psm.pd.States)[triggerData.DestinationState]
+	if err := psm.pd.validateArgs(trigger, args); err != nil {
+		return payload, err
+	}
+
+	triggerData, err := selectPermit(state, trigger, permits, evaluateGuards(ctx, payload, state, trigger, permits, args))
+	if err != nil {
+		if len(permits) == 1 {
+			return payload, plinkoerror.WrapPlinkoTriggerError(trigger, err, fmt.Sprintf("Conditional Trigger '%s' conditions not met for state: %s", trigger, state))
+		}
+		return payload, err
+	}
+
+	destination, err := triggerData.resolveDestination(ctx, payload)
+	if err != nil {
+		return payload, err
+	}
+
+	destinationState := (*psm.pd.States)[destination]
+
+	if destinationState == nil {
+		return payload, plinkoerror.CreatePlinkoStateError(destination, fmt.Sprintf("State not found in definition of states: %s", destination))
+	}
 
 	td := &sideeffects.TransitionDef{
 		Source:      state,
 		Destination: destinationState.State,
 		Trigger:     trigger,
+		Args:        args,
 	}
 
-	if triggerData.Predicate != nil {
-		if err := triggerData.Predicate(ctx, payload, td); err != nil {
-			return payload, plinkoerror.CreatePlinkoTriggerError(trigger, fmt.Sprintf("Conditional Trigger '%s' conditions not met for state: %s", trigger, state))
-		}
+	if triggerData.Internal != nil {
+		return psm.fireInternal(ctx, start, payload, triggerData, td)
 	}
 
+	if payload, err = psm.transition(ctx, start, payload, td); err != nil {
+		return payload, err
+	}
+
+	return psm.followAutoTransitions(ctx, start, payload, td.Destination)
+}
+
+// transition moves the payload from the source to the destination of td, running the exit and entry
+// chains of the states crossed and raising the side effects of each phase.
+func (psm plinkoStateMachine) transition(ctx context.Context, start time.Time, payload plinko.Payload, td *sideeffects.TransitionDef) (plinko.Payload, error) {
+	exits, entries := psm.pd.transitionPath(td.Source, td.Destination)
+
 	sideeffects.Dispatch(ctx, plinko.BeforeTransition, psm.pd.SideEffects, payload, td, time.Since(start).Milliseconds())
 
-	payload, err := sd2.Callbacks.ExecuteExitChain(ctx, payload, td)
+	journal := &composition.Journal{}
+	payload, err := executeExitChains(ctx, exits, payload, td, journal)
 
 	if err != nil {
-		payload, td, errSub := sd2.Callbacks.ExecuteErrorChain(ctx, payload, td, err, time.Since(start).Milliseconds())
+		intendedDestination := td.Destination
+		payload, td, errSub := psm.handleError(ctx, start, td.Source, payload, td, err)
+		sideeffects.Dispatch(ctx, plinko.BetweenStates, psm.pd.SideEffects, payload, td, time.Since(start).Milliseconds())
 
-		if errSub != nil {
+		if !isRedirect(err, errSub, intendedDestination, td) {
 			// this ensures that the error condition is trapped and not overridden to the caller of the trigger function
-			err = errSub
+			return journal.Compensate(ctx, payload, td, errSub)
 		}
-		sideeffects.Dispatch(ctx, plinko.BetweenStates, psm.pd.SideEffects, payload, td, time.Since(start).Milliseconds())
-		return payload, err
+
+		// the payload still leaves the source state, so the exit steps stand
+		return psm.redirect(ctx, start, payload, td, intendedDestination, err, journal)
 	}
 
+	psm.updateState(payload, td.Destination, plinko.UpdateStateBeforeEntry)
 	sideeffects.Dispatch(ctx, plinko.BetweenStates, psm.pd.SideEffects, payload, td, time.Since(start).Milliseconds())
 
-	payload, err = destinationState.Callbacks.ExecuteEntryChain(ctx, payload, td)
+	mark := journal.Len()
+	payload, err = executeEntryChains(ctx, entries, payload, td, journal)
 	if err != nil {
-		var errSub error
+		intendedDestination := td.Destination
+		payload, td, errSub := psm.handleError(ctx, start, td.Destination, payload, td, err)
 
-		payload, mtd, errSub := destinationState.Callbacks.ExecuteErrorChain(ctx, payload, td, err, time.Since(start).Milliseconds())
-		_ = &sideeffects.TransitionDef{
-			Source:      mtd.GetSource(),
-			Destination: mtd.GetDestination(),
-			Trigger:     mtd.GetTrigger(),
+		if !isRedirect(err, errSub, intendedDestination, td) {
+			psm.restoreState(payload, td.Source)
+			return journal.Compensate(ctx, payload, td, errSub)
 		}
 
-		if errSub != nil {
-			err = errSub
+		if payload, errSub = psm.abandonEntry(ctx, payload, td, err, journal, mark); errSub != err {
+			return payload, errSub
 		}
 
-		return payload, err
+		return psm.redirect(ctx, start, payload, td, intendedDestination, err, journal)
 	}
 
+	psm.updateState(payload, td.Destination, plinko.UpdateStateAfterEntry)
 	sideeffects.Dispatch(ctx, plinko.AfterTransition, psm.pd.SideEffects, payload, td, time.Since(start).Milliseconds())
 
 	return payload, nil
 }
+
+// followAutoTransitions takes the completion transitions declared with PermitAuto and PermitAutoIf from
+// each state the payload lands in, until a state has none whose guard passes.  The length of the chain is
+// bounded by DefinitionConfig.MaxAutoTransitions.
+func (psm plinkoStateMachine) followAutoTransitions(ctx context.Context, start time.Time, payload plinko.Payload, state plinko.State) (plinko.Payload, error) {
+	for count := 0; ; count++ {
+		auto := psm.pd.selectAutoTransition(ctx, payload, state)
+		if auto == nil {
+			return payload, nil
+		}
+
+		if count >= psm.pd.maxAutoTransitions() {
+			return payload, plinkoerror.CreatePlinkoTriggerError(plinko.CompletionTrigger, fmt.Sprintf("Automatic transitions exceeded the maximum chain length of %d at state: %s", psm.pd.maxAutoTransitions(), state))
+		}
+
+		td := &sideeffects.TransitionDef{
+			Source:      state,
+			Destination: auto.DestinationState,
+			Trigger:     plinko.CompletionTrigger,
+		}
+
+		if err := ctx.Err(); err != nil {
+			return payload, plinkoerror.CreatePlinkoContextError(err, *td, 0, "")
+		}
+
+		var err error
+		if payload, err = psm.transition(ctx, start, payload, td); err != nil {
+			return payload, err
+		}
+
+		state = td.Destination
+	}
+}
+
+// fireInternal runs the operation of an internal transition.  The state's exit and entry chains are
+// skipped and only the InternalAction side effect is raised.
+func (psm plinkoStateMachine) fireInternal(ctx context.Context, start time.Time, payload plinko.Payload, triggerData *TriggerDefinition, td *sideeffects.TransitionDef) (plinko.Payload, error) {
+	sd := (*psm.pd.States)[triggerData.Source]
+	payload, err := sd.Callbacks.ExecuteInternalChain(ctx, triggerData.Internal, payload, td)
+
+	if err != nil {
+		intendedDestination := td.Destination
+		payload, td, errSub := psm.handleError(ctx, start, td.Source, payload, td, err)
+
+		if !isRedirect(err, errSub, intendedDestination, td) {
+			return payload, errSub
+		}
+
+		return psm.redirect(ctx, start, payload, td, intendedDestination, err, &composition.Journal{})
+	}
+
+	sideeffects.Dispatch(ctx, plinko.InternalAction, psm.pd.SideEffects, payload, td, time.Since(start).Milliseconds())
+
+	return payload, nil
+}
+
+// updateState writes the landing state to payloads implementing plinko.MutablePayload when the
+// definition is configured to update state at the given point of the transition.
+func (psm plinkoStateMachine) updateState(payload plinko.Payload, state plinko.State, point plinko.StateUpdatePoint) {
+	if psm.pd.Config.StateUpdate != point {
+		return
+	}
+
+	if mp, ok := payload.(plinko.MutablePayload); ok {
+		mp.SetState(state)
+	}
+}
+
+// restoreState writes the source state back to a payload that was moved to its destination before an
+// entry chain that then failed, so the payload doesn't claim a state it never entered.
+func (psm plinkoStateMachine) restoreState(payload plinko.Payload, source plinko.State) {
+	psm.updateState(payload, source, plinko.UpdateStateBeforeEntry)
+}
+
+// handleError runs the error chains of the state and its superstates for a failed step.  When the step
+// failed because the context was done, the cancellation is also reported to the side effects.
+func (psm plinkoStateMachine) handleError(ctx context.Context, start time.Time, state plinko.State, payload plinko.Payload, td *sideeffects.TransitionDef, err error) (plinko.Payload, *sideeffects.TransitionDef, error) {
+	payload, td, errSub := executeErrorChains(ctx, psm.pd.ancestry(state), payload, td, err, time.Since(start).Milliseconds())
+
+	var pce *plinkoerror.PlinkoContextError
+	if errors.As(err, &pce) {
+		sideeffects.Dispatch(ctx, plinko.TransitionCanceled, psm.pd.SideEffects, payload, td, time.Since(start).Milliseconds())
+	}
+
+	return payload, td, errSub
+}
+
+// isRedirect reports whether an error chain moved the transition to a new destination.  An error
+// handler that fails with an error of its own is fatal, so its destination change is not honored.
+func isRedirect(err, errSub error, intendedDestination plinko.State, td *sideeffects.TransitionDef) bool {
+	return errors.Is(errSub, err) && td.Destination != intendedDestination
+}
+
+// redirect enters the destination chosen by an OnError handler.  When the redirected state's entry
+// chain fails as well, that state's error chain runs and may redirect again; landing on a state that
+// was already attempted during this Fire is reported as a redirect loop.
+func (psm plinkoStateMachine) redirect(ctx context.Context, start time.Time, payload plinko.Payload, td *sideeffects.TransitionDef, originalDestination plinko.State, cause error, journal *composition.Journal) (plinko.Payload, error) {
+	visited := []plinko.State{originalDestination}
+
+	for {
+		if findDestinationState(visited, td.Destination) {
+			return payload, plinkoerror.CreatePlinkoRedirectLoopError(*td, visited, cause)
+		}
+		visited = append(visited, td.Destination)
+
+		if (*psm.pd.States)[td.Destination] == nil {
+			return payload, plinkoerror.CreatePlinkoStateError(td.Destination, fmt.Sprintf("Redirected state not found in definition of states: %s", td.Destination))
+		}
+
+		psm.updateState(payload, td.Destination, plinko.UpdateStateBeforeEntry)
+
+		_, entries := psm.pd.transitionPath(td.Source, td.Destination)
+
+		var err, errSub error
+		mark := journal.Len()
+		payload, err = executeEntryChains(ctx, entries, payload, td, journal)
+		if err == nil {
+			psm.updateState(payload, td.Destination, plinko.UpdateStateAfterEntry)
+			sideeffects.Dispatch(ctx, plinko.AfterTransition, psm.pd.SideEffects, payload, td, time.Since(start).Milliseconds())
+
+			return payload, plinkoerror.CreatePlinkoRedirectError(*td, originalDestination, cause)
+		}
+
+		intendedDestination := td.Destination
+		payload, td, errSub = psm.handleError(ctx, start, td.Destination, payload, td, err)
+
+		if !isRedirect(err, errSub, intendedDestination, td) {
+			psm.restoreState(payload, td.Source)
+			return journal.Compensate(ctx, payload, td, errSub)
+		}
+
+		if payload, errSub = psm.abandonEntry(ctx, payload, td, err, journal, mark); errSub != err {
+			return payload, errSub
+		}
+	}
+}
+
+// abandonEntry undoes the entry steps recorded from mark on, which belong to a destination an OnError
+// handler redirected away from.  The exit steps stand, as the payload still leaves its state.  When one of
+// the compensations fails, the redirect is given up: the remaining steps are undone and the payload goes
+// back to the source state.  It returns err when the redirect can go ahead.
+func (psm plinkoStateMachine) abandonEntry(ctx context.Context, payload plinko.Payload, td *sideeffects.TransitionDef, err error, journal *composition.Journal, mark int) (plinko.Payload, error) {
+	payload, errComp := journal.CompensateFrom(ctx, payload, td, err, mark)
+	if errComp == err {
+		return payload, err
+	}
+
+	psm.restoreState(payload, td.Source)
+	return journal.Compensate(ctx, payload, td, errComp)
+}
@@ -9,9 +9,12 @@ package runtime
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/pkg/config/operation"
 	"github.com/shipt/plinko/plinkoerror"
 	"github.com/stretchr/testify/assert"
 )
@@ -363,3 +366,906 @@ func TestEnumerateTriggers(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, 0, len(triggers))
 }
+
+func RedirectTo(state plinko.State) plinko.ErrorOperation {
+	return func(_ context.Context, p plinko.Payload, m plinko.ModifiableTransitionInfo, e error) (plinko.Payload, error) {
+		m.SetDestination(state)
+		return p, nil
+	}
+}
+
+func TestFireWithEntryErrorRedirect(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		OnEntry(TransitionFn(true)).
+		OnError(RedirectTo(Canceled))
+
+	p.Configure(Canceled).
+		OnEntry(TransitionFn(false))
+
+	var actions []plinko.StateAction
+	var last plinko.TransitionInfo
+	p.SideEffect(func(_ context.Context, sa plinko.StateAction, _ plinko.Payload, ti plinko.TransitionInfo, _ int64) {
+		actions = append(actions, sa)
+		last = ti
+	})
+
+	psm := p.Compile().StateMachine
+
+	pr, err := psm.Fire(context.TODO(), &testPayload{state: Created}, Open)
+
+	var re *plinkoerror.PlinkoRedirectError
+	assert.True(t, errors.As(err, &re))
+	assert.Equal(t, Canceled, re.GetDestination())
+	assert.Equal(t, Opened, re.OriginalDestination)
+	assert.Equal(t, "error", errors.Unwrap(err).Error())
+
+	assert.Equal(t, Canceled, pr.GetState())
+	assert.Equal(t, []plinko.StateAction{plinko.BeforeTransition, plinko.BetweenStates, plinko.AfterTransition}, actions)
+	assert.Equal(t, Canceled, last.GetDestination())
+}
+
+func TestFireWithExitErrorRedirect(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened).
+		OnExit(TransitionFn(true)).
+		OnError(RedirectTo(Canceled))
+
+	p.Configure(Opened)
+	p.Configure(Canceled).
+		OnEntry(TransitionFn(false))
+
+	psm := p.Compile().StateMachine
+
+	pr, err := psm.Fire(context.TODO(), &testPayload{state: Created}, Open)
+
+	var re *plinkoerror.PlinkoRedirectError
+	assert.True(t, errors.As(err, &re))
+	assert.Equal(t, Canceled, pr.GetState())
+}
+
+func TestFireWithRedirectLoop(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		OnEntry(TransitionFn(true)).
+		OnError(RedirectTo(Canceled))
+
+	p.Configure(Canceled).
+		OnEntry(TransitionFn(true)).
+		OnError(RedirectTo(Opened))
+
+	psm := p.Compile().StateMachine
+
+	_, err := psm.Fire(context.TODO(), &testPayload{state: Created}, Open)
+
+	var le *plinkoerror.PlinkoRedirectLoopError
+	assert.True(t, errors.As(err, &le))
+	assert.Equal(t, []plinko.State{Opened, Canceled}, le.States)
+}
+
+func TestFireWithRedirectToUndefinedState(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		OnEntry(TransitionFn(true)).
+		OnError(RedirectTo("Triage"))
+
+	psm := p.Compile().StateMachine
+
+	_, err := psm.Fire(context.TODO(), &testPayload{state: Created}, Open)
+
+	var se *plinkoerror.PlinkoStateError
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, plinko.State("Triage"), se.State)
+}
+
+func TestFireWithFatalErrorHandlerIgnoresRedirect(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		OnEntry(TransitionFn(true)).
+		OnError(func(_ context.Context, p plinko.Payload, m plinko.ModifiableTransitionInfo, e error) (plinko.Payload, error) {
+			m.SetDestination(Canceled)
+			return p, errors.New("fatal")
+		})
+
+	entered := false
+	p.Configure(Canceled).
+		OnEntry(func(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+			entered = true
+			return p, nil
+		})
+
+	psm := p.Compile().StateMachine
+
+	_, err := psm.Fire(context.TODO(), &testPayload{state: Created}, Open)
+
+	assert.Equal(t, "fatal", err.Error())
+	assert.False(t, entered)
+}
+
+type mutablePayload struct {
+	testPayload
+	history []plinko.State
+}
+
+func (p *mutablePayload) SetState(state plinko.State) {
+	p.state = state
+	p.history = append(p.history, state)
+}
+
+func createPlinkoDefinitionWithConfig(cfg plinko.DefinitionConfig) plinko.PlinkoDefinition {
+	stateMap := make(map[plinko.State]*InternalStateDefinition)
+	p := PlinkoDefinition{
+		States: &stateMap,
+		Config: cfg,
+	}
+
+	return &p
+}
+
+func RecordState(states *[]plinko.State) plinko.Operation {
+	return func(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+		*states = append(*states, p.GetState())
+		return p, nil
+	}
+}
+
+func TestFireUpdatesMutablePayloadAfterEntry(t *testing.T) {
+	var seen []plinko.State
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		OnEntry(RecordState(&seen))
+
+	psm := p.Compile().StateMachine
+
+	payload := &mutablePayload{testPayload: testPayload{state: Created}}
+	pr, err := psm.Fire(context.TODO(), payload, Open)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Opened, pr.GetState())
+	assert.Equal(t, []plinko.State{Created}, seen)
+	assert.Equal(t, []plinko.State{Opened}, payload.history)
+}
+
+func TestFireUpdatesMutablePayloadBeforeEntry(t *testing.T) {
+	var seen []plinko.State
+	p := createPlinkoDefinitionWithConfig(plinko.DefinitionConfig{StateUpdate: plinko.UpdateStateBeforeEntry})
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		OnEntry(RecordState(&seen))
+
+	psm := p.Compile().StateMachine
+
+	payload := &mutablePayload{testPayload: testPayload{state: Created}}
+	pr, err := psm.Fire(context.TODO(), payload, Open)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Opened, pr.GetState())
+	assert.Equal(t, []plinko.State{Opened}, seen)
+	assert.Equal(t, []plinko.State{Opened}, payload.history)
+}
+
+func TestFireDoesNotUpdateMutablePayloadOnEntryFailure(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		OnEntry(TransitionFn(true))
+
+	psm := p.Compile().StateMachine
+
+	payload := &mutablePayload{testPayload: testPayload{state: Created}}
+	pr, err := psm.Fire(context.TODO(), payload, Open)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, Created, pr.GetState())
+	assert.Nil(t, payload.history)
+}
+
+func TestFireRestoresMutablePayloadOnEntryFailureBeforeEntry(t *testing.T) {
+	p := createPlinkoDefinitionWithConfig(plinko.DefinitionConfig{StateUpdate: plinko.UpdateStateBeforeEntry})
+
+	p.Configure(Created).
+		Permit(Open, Opened).
+		Permit(Claim, Claimed)
+
+	p.Configure(Opened).
+		OnEntry(TransitionFn(true))
+
+	p.Configure(Claimed).
+		OnEntry(TransitionFn(true)).
+		OnError(RedirectTo(Opened))
+
+	psm := p.Compile().StateMachine
+
+	payload := &mutablePayload{testPayload: testPayload{state: Created}}
+	pr, err := psm.Fire(context.TODO(), payload, Open)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, Created, pr.GetState())
+	assert.Equal(t, []plinko.State{Opened, Created}, payload.history)
+
+	// the redirected state's entry chain fails as well
+	payload = &mutablePayload{testPayload: testPayload{state: Created}}
+	pr, err = psm.Fire(context.TODO(), payload, Claim)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, Created, pr.GetState())
+	assert.Equal(t, []plinko.State{Claimed, Opened, Created}, payload.history)
+}
+
+func TestFireUpdatesMutablePayloadAfterRedirect(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		OnEntry(TransitionFn(true)).
+		OnError(RedirectTo(Canceled))
+
+	p.Configure(Canceled)
+
+	psm := p.Compile().StateMachine
+
+	payload := &mutablePayload{testPayload: testPayload{state: Created}}
+	pr, err := psm.Fire(context.TODO(), payload, Open)
+
+	var re *plinkoerror.PlinkoRedirectError
+	assert.True(t, errors.As(err, &re))
+	assert.Equal(t, Canceled, pr.GetState())
+	assert.Equal(t, []plinko.State{Canceled}, payload.history)
+}
+
+const Refunded plinko.State = "Refunded"
+const ReturnPending plinko.State = "ReturnPending"
+
+func TestFireWithPermitDynamic(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	var selected plinko.State
+	var selectorErr error
+	p.Configure(Delivered).
+		PermitDynamic(Return, func(_ context.Context, _ plinko.Payload) (plinko.State, error) {
+			return selected, selectorErr
+		}, []plinko.State{Refunded, ReturnPending})
+
+	p.Configure(Refunded)
+	p.Configure(ReturnPending)
+	p.Configure(Canceled)
+
+	psm := p.Compile().StateMachine
+
+	selected = ReturnPending
+	pr, err := psm.Fire(context.TODO(), &mutablePayload{testPayload: testPayload{state: Delivered}}, Return)
+	assert.Nil(t, err)
+	assert.Equal(t, ReturnPending, pr.GetState())
+
+	selected = Refunded
+	pr, err = psm.Fire(context.TODO(), &mutablePayload{testPayload: testPayload{state: Delivered}}, Return)
+	assert.Nil(t, err)
+	assert.Equal(t, Refunded, pr.GetState())
+
+	selected = Canceled
+	pr, err = psm.Fire(context.TODO(), &mutablePayload{testPayload: testPayload{state: Delivered}}, Return)
+	var pse *plinkoerror.PlinkoStateError
+	assert.True(t, errors.As(err, &pse))
+	assert.Equal(t, Canceled, pse.State)
+	assert.Equal(t, Delivered, pr.GetState())
+
+	selectorErr = errors.New("payment lookup failed")
+	_, err = psm.Fire(context.TODO(), &mutablePayload{testPayload: testPayload{state: Delivered}}, Return)
+	assert.Equal(t, selectorErr, err)
+}
+
+func TestFirePermitDynamicSelectorPanic(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Delivered).
+		PermitDynamic(Return, func(_ context.Context, _ plinko.Payload) (plinko.State, error) {
+			panic("payment lookup failed")
+		}, []plinko.State{Refunded, ReturnPending}).
+		PermitIf(IsCurbside, Return, Canceled)
+
+	p.Configure(Refunded)
+	p.Configure(ReturnPending)
+	p.Configure(Canceled)
+
+	psm := p.Compile().StateMachine
+
+	payload := &curbsidePayload{mutablePayload: mutablePayload{testPayload: testPayload{state: Delivered}}}
+	pr, err := psm.Fire(context.TODO(), payload, Return)
+	var ppe *plinkoerror.PlinkoPanicError
+	assert.True(t, errors.As(err, &ppe))
+	assert.Equal(t, Delivered, pr.GetState())
+
+	// the selector of the unguarded permit only runs when no guard passes
+	payload.curbside = true
+	pr, err = psm.Fire(context.TODO(), payload, Return)
+	assert.Nil(t, err)
+	assert.Equal(t, Canceled, pr.GetState())
+}
+
+func TestPermitDynamicNamedSelector(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	selector := func(_ context.Context, _ plinko.Payload) (plinko.State, error) {
+		return Refunded, nil
+	}
+
+	p.Configure(Delivered).
+		PermitDynamic(Return, selector, []plinko.State{Refunded}, operation.WithName("orders.ChooseRefund"))
+
+	var selectors []string
+	p.Describe(func(info plinko.StateInfo) {
+		for _, permit := range info.Permits {
+			selectors = append(selectors, permit.SelectorName)
+		}
+	})
+	assert.Equal(t, []string{"orders.ChooseRefund"}, selectors)
+
+	assert.Panics(t, func() {
+		p.Configure(Refunded).PermitDynamic(Return, selector, []plinko.State{Refunded}, operation.WithTimeout(time.Second))
+	})
+}
+
+type curbsidePayload struct {
+	mutablePayload
+	curbside bool
+	express  bool
+}
+
+func IsCurbside(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) error {
+	if p.(*curbsidePayload).curbside {
+		return nil
+	}
+	return errors.New("not curbside")
+}
+
+func IsInStore(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) error {
+	cp := p.(*curbsidePayload)
+	if !cp.curbside || cp.express {
+		return nil
+	}
+	return errors.New("curbside")
+}
+
+func TestFireWithMultipleGuardedPermits(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Claimed).
+		PermitIf(IsCurbside, Submit, ArriveAtStore).
+		PermitIf(IsInStore, Submit, MarkedAsPickedUp)
+
+	p.Configure(ArriveAtStore)
+	p.Configure(MarkedAsPickedUp)
+
+	psm := p.Compile().StateMachine
+
+	payload := &curbsidePayload{mutablePayload: mutablePayload{testPayload: testPayload{state: Claimed}}, curbside: true}
+	assert.Nil(t, psm.CanFire(context.TODO(), payload, Submit))
+	pr, err := psm.Fire(context.TODO(), payload, Submit)
+	assert.Nil(t, err)
+	assert.Equal(t, ArriveAtStore, pr.GetState())
+
+	payload = &curbsidePayload{mutablePayload: mutablePayload{testPayload: testPayload{state: Claimed}}}
+	pr, err = psm.Fire(context.TODO(), payload, Submit)
+	assert.Nil(t, err)
+	assert.Equal(t, MarkedAsPickedUp, pr.GetState())
+
+	// both guards pass, the permits are not mutually exclusive for this payload
+	payload = &curbsidePayload{mutablePayload: mutablePayload{testPayload: testPayload{state: Claimed}}, curbside: true, express: true}
+	pr, err = psm.Fire(context.TODO(), payload, Submit)
+
+	var pge *plinkoerror.PlinkoGuardError
+	assert.True(t, errors.As(err, &pge))
+	assert.Equal(t, []plinko.State{ArriveAtStore, MarkedAsPickedUp}, pge.Destinations)
+	assert.Equal(t, Claimed, pr.GetState())
+	assert.Equal(t, err, psm.CanFire(context.TODO(), payload, Submit))
+}
+
+func TestFireFallsBackToUnguardedPermit(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Claimed).
+		PermitIf(IsCurbside, Submit, ArriveAtStore).
+		Permit(Submit, MarkedAsPickedUp)
+
+	p.Configure(ArriveAtStore)
+	p.Configure(MarkedAsPickedUp)
+
+	psm := p.Compile().StateMachine
+
+	payload := &curbsidePayload{mutablePayload: mutablePayload{testPayload: testPayload{state: Claimed}}, curbside: true}
+	pr, err := psm.Fire(context.TODO(), payload, Submit)
+	assert.Nil(t, err)
+	assert.Equal(t, ArriveAtStore, pr.GetState())
+
+	payload = &curbsidePayload{mutablePayload: mutablePayload{testPayload: testPayload{state: Claimed}}}
+	pr, err = psm.Fire(context.TODO(), payload, Submit)
+	assert.Nil(t, err)
+	assert.Equal(t, MarkedAsPickedUp, pr.GetState())
+}
+
+func TestFireWithNoGuardPassing(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Claimed).
+		PermitIf(IsCurbside, Submit, ArriveAtStore).
+		PermitIf(IsCurbside, Submit, MarkedAsPickedUp)
+
+	p.Configure(ArriveAtStore)
+	p.Configure(MarkedAsPickedUp)
+
+	psm := p.Compile().StateMachine
+
+	payload := &curbsidePayload{mutablePayload: mutablePayload{testPayload: testPayload{state: Claimed}}}
+	_, err := psm.Fire(context.TODO(), payload, Submit)
+
+	var pge *plinkoerror.PlinkoGuardError
+	assert.True(t, errors.As(err, &pge))
+	assert.Empty(t, pge.Destinations)
+	assert.Equal(t, []error{errors.New("not curbside"), errors.New("not curbside")}, pge.Causes)
+	assert.Equal(t, "No guard passed for Trigger 'Submit' in state: Claimed", err.Error())
+}
+
+func TestCompileUnguardedPermitShadowsGuardedPermits(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Claimed).
+		PermitIf(IsCurbside, Submit, ArriveAtStore).
+		Permit(Submit, MarkedAsPickedUp).
+		PermitIf(IsInStore, Submit, MarkedAsPickedUp)
+
+	p.Configure(ArriveAtStore).
+		PermitReentry(Submit)
+	p.Configure(MarkedAsPickedUp).
+		PermitReentry(Submit)
+
+	assert.Panics(t, func() {
+		p.Configure(Opened).
+			PermitIf(IsCurbside, Submit, ArriveAtStore).
+			Permit(Submit, MarkedAsPickedUp).
+			PermitReentry(Submit)
+	})
+
+	co := p.Compile()
+	assert.Equal(t, []plinko.CompilerMessage{{
+		CompileMessage: plinko.CompileWarning,
+		Message:        "State 'Claimed' declares an unguarded permit for Trigger 'Submit' that is only taken when none of its guarded permits passes.",
+		Code:           plinko.ShadowedPermitCode,
+	}, {
+		CompileMessage: plinko.CompileWarning,
+		Message:        "State 'Opened' declares an unguarded permit for Trigger 'Submit' that is only taken when none of its guarded permits passes.",
+		Code:           plinko.ShadowedPermitCode,
+	}, missingInitialState}, co.Messages)
+}
+
+func TestFireWithInternalTransition(t *testing.T) {
+	var steps []string
+	p := createPlinkoDefinition()
+
+	p.Configure(Opened).
+		OnEntry(RecordStep(&steps, "enter Opened")).
+		OnExit(RecordStep(&steps, "exit Opened")).
+		InternalTransition(AddItemToOrder, RecordStep(&steps, "add item"))
+
+	var actions []plinko.StateAction
+	var info plinko.TransitionInfo
+	p.SideEffect(func(_ context.Context, sa plinko.StateAction, _ plinko.Payload, ti plinko.TransitionInfo, _ int64) {
+		actions = append(actions, sa)
+		info = ti
+	})
+
+	psm := p.Compile().StateMachine
+
+	payload := &mutablePayload{testPayload: testPayload{state: Opened}}
+	pr, err := psm.Fire(context.TODO(), payload, AddItemToOrder)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Opened, pr.GetState())
+	assert.Nil(t, payload.history)
+	assert.Equal(t, []string{"add item"}, steps)
+	assert.Equal(t, []plinko.StateAction{plinko.InternalAction}, actions)
+	assert.Equal(t, Opened, info.GetSource())
+	assert.Equal(t, Opened, info.GetDestination())
+}
+
+func TestFireWithFailingInternalTransition(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	handled := false
+	p.Configure(Opened).
+		InternalTransition(AddItemToOrder, TransitionFn(true)).
+		OnError(func(_ context.Context, p plinko.Payload, _ plinko.ModifiableTransitionInfo, _ error) (plinko.Payload, error) {
+			handled = true
+			return p, nil
+		})
+
+	var actions []plinko.StateAction
+	p.SideEffect(func(_ context.Context, sa plinko.StateAction, _ plinko.Payload, _ plinko.TransitionInfo, _ int64) {
+		actions = append(actions, sa)
+	})
+
+	psm := p.Compile().StateMachine
+
+	_, err := psm.Fire(context.TODO(), &testPayload{state: Opened}, AddItemToOrder)
+
+	assert.Equal(t, errors.New("error"), err)
+	assert.True(t, handled)
+	assert.Empty(t, actions)
+}
+
+func TestFireWithIgnoredTrigger(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Active).
+		Permit(Cancel, Canceled).
+		Permit(Return, Returned)
+
+	p.Configure(Opened).
+		SubstateOf(Active).
+		Ignore(Cancel).
+		Ignore(Claim)
+
+	p.Configure(Canceled)
+	p.Configure(Returned)
+
+	var actions []plinko.StateAction
+	p.SideEffect(func(_ context.Context, sa plinko.StateAction, _ plinko.Payload, _ plinko.TransitionInfo, _ int64) {
+		actions = append(actions, sa)
+	})
+
+	psm := p.Compile().StateMachine
+	payload := &mutablePayload{testPayload: testPayload{state: Opened}}
+
+	pr, err := psm.Fire(context.TODO(), payload, Claim)
+	assert.Nil(t, err)
+	assert.Equal(t, Opened, pr.GetState())
+
+	pr, err = psm.Fire(context.TODO(), payload, Cancel)
+	assert.Nil(t, err)
+	assert.Equal(t, Opened, pr.GetState())
+	assert.Empty(t, actions)
+
+	assert.Nil(t, psm.CanFire(context.TODO(), payload, Cancel))
+
+	triggers, err := psm.EnumerateActiveTriggers(payload)
+	assert.Nil(t, err)
+	assert.Equal(t, []plinko.Trigger{Return}, triggers)
+
+	assert.Panics(t, func() {
+		p.Configure(Claimed).
+			Ignore(Cancel).
+			Permit(Cancel, Canceled)
+	})
+	assert.Panics(t, func() {
+		p.Configure(Delivered).
+			Permit(Cancel, Canceled).
+			Ignore(Cancel)
+	})
+}
+
+func TestFireWithUnhandledTriggerHandler(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	var unhandled []plinko.Trigger
+	p.OnUnhandledTrigger(func(_ context.Context, _ plinko.Payload, trigger plinko.Trigger) error {
+		unhandled = append(unhandled, trigger)
+		if trigger == Deliver {
+			return errors.New("deliver is not supported")
+		}
+		return nil
+	})
+
+	p.Configure(Opened).
+		Permit(Claim, Claimed)
+
+	p.Configure(Claimed)
+
+	psm := p.Compile().StateMachine
+	payload := &testPayload{state: Opened}
+
+	pr, err := psm.Fire(context.TODO(), payload, Return)
+	assert.Nil(t, err)
+	assert.Equal(t, Opened, pr.GetState())
+
+	_, err = psm.Fire(context.TODO(), payload, Deliver)
+	assert.Equal(t, "deliver is not supported", err.Error())
+
+	assert.Equal(t, []plinko.Trigger{Return, Deliver}, unhandled)
+
+	// state errors are not routed through the handler
+	_, err = psm.Fire(context.TODO(), &testPayload{state: "Unknown"}, Return)
+	var pse *plinkoerror.PlinkoStateError
+	assert.True(t, errors.As(err, &pse))
+}
+
+func TestFireStopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var steps []string
+	var handledErr error
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		OnEntry(func(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+			steps = append(steps, "first")
+			cancel()
+			return p, nil
+		}).
+		OnEntry(RecordStep(&steps, "second")).
+		OnError(func(_ context.Context, p plinko.Payload, _ plinko.ModifiableTransitionInfo, e error) (plinko.Payload, error) {
+			handledErr = e
+			return p, nil
+		})
+
+	var actions []plinko.StateAction
+	p.SideEffect(func(_ context.Context, sa plinko.StateAction, _ plinko.Payload, _ plinko.TransitionInfo, _ int64) {
+		actions = append(actions, sa)
+	})
+
+	psm := p.Compile().StateMachine
+
+	payload := &mutablePayload{testPayload: testPayload{state: Created}}
+	_, err := psm.Fire(ctx, payload, Open)
+
+	var pce *plinkoerror.PlinkoContextError
+	assert.True(t, errors.As(err, &pce))
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, err, handledErr)
+	assert.Equal(t, []string{"first"}, steps)
+	assert.Equal(t, []plinko.StateAction{plinko.BeforeTransition, plinko.BetweenStates, plinko.TransitionCanceled}, actions)
+	assert.Nil(t, payload.history)
+
+	// a context that is already done doesn't start the transition
+	actions = nil
+	steps = nil
+	_, err = psm.Fire(ctx, payload, Open)
+
+	if assert.True(t, errors.As(err, &pce)) {
+		assert.Equal(t, Created, pce.GetSource())
+		assert.Equal(t, Open, pce.GetTrigger())
+	}
+	assert.Empty(t, steps)
+	assert.Empty(t, actions)
+}
+
+func TestFireWithInterceptors(t *testing.T) {
+	var steps []string
+	var seen []string
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		OnExit(RecordStep(&steps, "leave created"), operation.WithName("LeaveCreated")).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		OnEntry(RecordStep(&steps, "enter opened"), operation.WithName("EnterOpened")).
+		InternalTransition(AddItemToOrder, RecordStep(&steps, "add item"), operation.WithName("AddItem"))
+
+	// interceptors registered after the states are configured still apply
+	p.Use(func(next plinko.Operation, info plinko.OperationInfo) plinko.Operation {
+		return func(ctx context.Context, p plinko.Payload, ti plinko.TransitionInfo) (plinko.Payload, error) {
+			seen = append(seen, fmt.Sprintf("%s %s %s", info.State, info.Kind, info.Config.Name))
+			return next(ctx, p, ti)
+		}
+	})
+
+	psm := p.Compile().StateMachine
+
+	_, err := psm.Fire(context.TODO(), &testPayload{state: Created}, Open)
+	assert.Nil(t, err)
+
+	_, err = psm.Fire(context.TODO(), &testPayload{state: Opened}, AddItemToOrder)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"leave created", "enter opened", "add item"}, steps)
+	assert.Equal(t, []string{
+		"Created OnExit LeaveCreated",
+		"Opened OnEntry EnterOpened",
+		"Opened InternalTransition AddItem",
+	}, seen)
+}
+
+func HasItems(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) error {
+	if p.(*testPayload).condition {
+		return nil
+	}
+
+	return errors.New("order has no items")
+}
+
+func TestExplain(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		PermitIf(HasItems, Open, Opened).
+		PermitIf(PermitIfPredicate, Claim, Claimed).
+		Permit(Claim, Canceled).
+		Ignore(Submit)
+
+	p.Configure(Opened)
+	p.Configure(Claimed)
+	p.Configure(Canceled)
+
+	psm := p.Compile().StateMachine
+	payload := &testPayload{state: Created}
+
+	explanation := psm.Explain(context.TODO(), payload, Open)
+
+	assert.True(t, explanation.StateFound)
+	assert.True(t, explanation.TriggerDefined)
+	if assert.Len(t, explanation.Guards, 1) {
+		guard := explanation.Guards[0]
+		assert.Equal(t, "HasItems", guard.GuardName)
+		assert.Equal(t, []plinko.State{Opened}, guard.Destinations)
+		assert.False(t, guard.Passed)
+		assert.EqualError(t, guard.Err, "order has no items")
+	}
+	assert.Equal(t, explanation.Guards[0].Err, explanation.Err)
+	assert.Equal(t, explanation.Err, psm.CanFire(context.TODO(), payload, Open))
+
+	// Fire keeps the guard's error
+	_, err := psm.Fire(context.TODO(), payload, Open)
+	var pte *plinkoerror.PlinkoTriggerError
+	assert.True(t, errors.As(err, &pte))
+	assert.EqualError(t, errors.Unwrap(err), "order has no items")
+
+	explanation = psm.Explain(context.TODO(), payload, Claim)
+
+	assert.Nil(t, explanation.Err)
+	assert.Equal(t, []plinko.GuardResult{
+		{Destinations: []plinko.State{Claimed}, GuardName: "PermitIfPredicate", Passed: false, Err: errors.New("permit failed")},
+		{Destinations: []plinko.State{Canceled}, Passed: true},
+	}, explanation.Guards)
+
+	explanation = psm.Explain(context.TODO(), payload, Submit)
+	assert.True(t, explanation.Ignored)
+	assert.Nil(t, explanation.Err)
+
+	explanation = psm.Explain(context.TODO(), payload, Deliver)
+	assert.True(t, explanation.StateFound)
+	assert.False(t, explanation.TriggerDefined)
+	assert.IsType(t, &plinkoerror.PlinkoTriggerError{}, explanation.Err)
+
+	explanation = psm.Explain(context.TODO(), &testPayload{state: Delivered}, Deliver)
+	assert.False(t, explanation.StateFound)
+	assert.IsType(t, &plinkoerror.PlinkoStateError{}, explanation.Err)
+}
+
+func TestExplainNamedGuard(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Created).
+		PermitIf(HasItems, Open, Opened, operation.WithName("OrderHasItems")).
+		PermitReentryIf(PermitIfPredicate, Claim, operation.WithName("CanReclaim")).
+		PermitAutoIf(IsCurbside, Canceled, operation.WithName("PickedUpAtCurb"))
+
+	p.Configure(Opened)
+	p.Configure(Canceled)
+
+	var guards []string
+	p.Describe(func(info plinko.StateInfo) {
+		for _, permit := range info.Permits {
+			guards = append(guards, permit.GuardName)
+		}
+	})
+	assert.Equal(t, []string{"OrderHasItems", "CanReclaim", "PickedUpAtCurb"}, guards)
+
+	explanation := p.Compile().StateMachine.Explain(context.TODO(), &testPayload{state: Created}, Open)
+	if assert.Len(t, explanation.Guards, 1) {
+		assert.Equal(t, "OrderHasItems", explanation.Guards[0].GuardName)
+	}
+
+	assert.Panics(t, func() {
+		p.Configure(Opened).PermitIf(HasItems, Claim, Claimed, operation.WithTimeout(time.Second))
+	})
+}
+
+func TestEnumerateActiveTriggersContext(t *testing.T) {
+	p := createPlinkoDefinition()
+
+	p.Configure(Active).
+		Permit(Cancel, Canceled).
+		Permit(Return, Returned)
+
+	p.Configure(Created).
+		SubstateOf(Active).
+		PermitIf(HasItems, Open, Opened).
+		Permit(Submit, Claimed).
+		PermitIf(PermitIfPredicate, Claim, Claimed).
+		PermitIf(HasItems, Claim, Delivered).
+		Permit(Claim, Returned).
+		Ignore(Return)
+
+	p.Configure(Opened)
+	p.Configure(Claimed)
+	p.Configure(Canceled)
+	p.Configure(Delivered)
+	p.Configure(Returned)
+
+	psm := p.Compile().StateMachine
+	payload := &testPayload{state: Created}
+
+	for i := 0; i < 10; i++ {
+		triggers, err := psm.EnumerateActiveTriggers(payload)
+		assert.Nil(t, err)
+		assert.Equal(t, []plinko.Trigger{Open, Submit, Claim, Cancel}, triggers)
+	}
+
+	statuses, err := psm.EnumerateActiveTriggersContext(context.TODO(), payload, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []plinko.TriggerStatus{
+		{Trigger: Submit, Enabled: true},
+		{Trigger: Claim, Enabled: true},
+		{Trigger: Cancel, Enabled: true},
+	}, statuses)
+
+	statuses, err = psm.EnumerateActiveTriggersContext(context.TODO(), payload, true)
+	assert.Nil(t, err)
+	if assert.Len(t, statuses, 4) {
+		assert.Equal(t, Open, statuses[0].Trigger)
+		assert.False(t, statuses[0].Enabled)
+		assert.EqualError(t, statuses[0].Err, "order has no items")
+	}
+
+	payload.condition = true
+	statuses, err = psm.EnumerateActiveTriggersContext(context.TODO(), payload, false)
+	assert.Nil(t, err)
+	if assert.Len(t, statuses, 3) {
+		assert.Equal(t, Open, statuses[0].Trigger)
+	}
+
+	// both guards of Claim pass, so it can't be fired
+	statuses, err = psm.EnumerateActiveTriggersContext(context.TODO(), payload, true)
+	assert.Nil(t, err)
+	if assert.Len(t, statuses, 4) {
+		assert.False(t, statuses[2].Enabled)
+		assert.IsType(t, &plinkoerror.PlinkoGuardError{}, statuses[2].Err)
+	}
+
+	_, err = psm.EnumerateActiveTriggersContext(context.TODO(), &testPayload{state: Shopping}, true)
+	assert.IsType(t, &plinkoerror.PlinkoStateError{}, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = psm.EnumerateActiveTriggersContext(ctx, payload, true)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	var pce *plinkoerror.PlinkoContextError
+	if assert.True(t, errors.As(err, &pce)) {
+		assert.Equal(t, payload.GetState(), pce.GetSource())
+		assert.Equal(t, plinko.State(""), pce.GetDestination())
+	}
+}
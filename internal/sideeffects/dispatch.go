@@ -13,7 +13,7 @@ import (
 )
 
 // AllowAllSideEffects is a convenience constant for registering a global
-const AllowAllSideEffects = plinko.AllowBeforeTransition | plinko.AllowAfterTransition | plinko.AllowBetweenStates
+const AllowAllSideEffects = plinko.AllowBeforeTransition | plinko.AllowAfterTransition | plinko.AllowBetweenStates | plinko.AllowInternalAction | plinko.AllowTransitionCanceled
 
 // SideEffectDefinition holds the callback and filtering characteristics describing when the sideeffect is signaled.
 type SideEffectDefinition struct {
@@ -30,6 +30,10 @@ func getFilterDefinition(stateAction plinko.StateAction) plinko.SideEffectFilter
 		return plinko.AllowBetweenStates
 	case plinko.AfterTransition:
 		return plinko.AllowAfterTransition
+	case plinko.InternalAction:
+		return plinko.AllowInternalAction
+	case plinko.TransitionCanceled:
+		return plinko.AllowTransitionCanceled
 	}
 
 	return 0
@@ -40,6 +44,7 @@ type TransitionDef struct {
 	Source      plinko.State
 	Destination plinko.State
 	Trigger     plinko.Trigger
+	Args        []interface{}
 }
 
 // GetSource returns the Source / Starting state
@@ -64,6 +69,11 @@ func (td TransitionDef) GetTrigger() plinko.Trigger {
 	return td.Trigger
 }
 
+// GetArgs returns the arguments the trigger was fired with
+func (td TransitionDef) GetArgs() []interface{} {
+	return td.Args
+}
+
 // Dispatch is responsible for executing a set of declared side effect definitions when called upon.
 func Dispatch(ctx context.Context, stateAction plinko.StateAction, sideEffects []SideEffectDefinition, payload plinko.Payload, transitionInfo plinko.TransitionInfo, elapsedMilliseconds int64) int {
 	iCount := 0
@@ -95,11 +95,13 @@ func TestTransitionDefinition(t *testing.T) {
 		Source:      "foo1",
 		Destination: "foo2",
 		Trigger:     "foo3",
+		Args:        []interface{}{"foo5"},
 	}
 
 	assert.Equal(t, plinko.State("foo1"), td.GetSource())
 	assert.Equal(t, plinko.State("foo2"), td.GetDestination())
 	assert.Equal(t, plinko.Trigger("foo3"), td.GetTrigger())
+	assert.Equal(t, []interface{}{"foo5"}, td.GetArgs())
 
 	td.SetDestination("foo4")
 	assert.Equal(t, plinko.State("foo4"), td.GetDestination())
@@ -109,5 +111,7 @@ func TestStateActionToFilterMapping(t *testing.T) {
 	assert.Equal(t, plinko.SideEffectFilter(1), getFilterDefinition(plinko.BeforeTransition))
 	assert.Equal(t, plinko.SideEffectFilter(4), getFilterDefinition(plinko.AfterTransition))
 	assert.Equal(t, plinko.SideEffectFilter(2), getFilterDefinition(plinko.BetweenStates))
+	assert.Equal(t, plinko.SideEffectFilter(8), getFilterDefinition(plinko.InternalAction))
+	assert.Equal(t, plinko.SideEffectFilter(16), getFilterDefinition(plinko.TransitionCanceled))
 	assert.Equal(t, plinko.SideEffectFilter(0), getFilterDefinition("unknown"))
 }
@@ -6,13 +6,33 @@ import (
 )
 
 // CreatePlinkoDefinition ... creates a new structure used in defining the state machine.
-func CreatePlinkoDefinition() plinko.PlinkoDefinition {
+func CreatePlinkoDefinition(opts ...plinko.DefinitionOption) plinko.PlinkoDefinition {
 	stateMap := make(map[plinko.State]*runtime.InternalStateDefinition)
 	p := runtime.PlinkoDefinition{
 		States: &stateMap,
+		Config: newDefinitionConfig(opts...),
 	}
 
 	p.Abs = runtime.AbstractSyntax{}
 
 	return &p
 }
+
+func newDefinitionConfig(opts ...plinko.DefinitionOption) plinko.DefinitionConfig {
+	c := plinko.DefinitionConfig{
+		StateUpdate:        plinko.UpdateStateAfterEntry,
+		MaxAutoTransitions: plinko.DefaultMaxAutoTransitions,
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return c
+}
+
+// Diff reports the structural changes between two definitions: added and removed states, added, removed
+// and retargeted triggers, changed guards and changed operation chains.
+func Diff(a, b plinko.PlinkoDefinition) plinko.DefinitionDiff {
+	return runtime.Diff(a, b)
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/shipt/plinko"
 	"github.com/shipt/plinko/internal/runtime"
+	"github.com/shipt/plinko/pkg/config/definition"
 	"github.com/shipt/plinko/pkg/config/operation"
+	"github.com/shipt/plinko/plinkoerror"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -72,9 +76,10 @@ func TestUndefinedStateCompile(t *testing.T) {
 		Permit("Submit", "PublishedOrder")
 
 	compilerOutput := p.Compile()
-	assert.Equal(t, 1, len(compilerOutput.Messages))
+	assert.Equal(t, 2, len(compilerOutput.Messages))
 	assert.Equal(t, plinko.CompileError, compilerOutput.Messages[0].CompileMessage)
 	assert.Equal(t, "State 'PublishedOrder' undefined: Trigger 'Submit' declares a transition to this undefined state.", compilerOutput.Messages[0].Message)
+	assert.Equal(t, plinko.MissingInitialStateCode, compilerOutput.Messages[1].Code)
 }
 
 func TestTriggerlessStateCompile(t *testing.T) {
@@ -85,9 +90,10 @@ func TestTriggerlessStateCompile(t *testing.T) {
 	p.Configure("PublishedOrder")
 
 	compilerOutput := p.Compile()
-	assert.Equal(t, 1, len(compilerOutput.Messages))
+	assert.Equal(t, 2, len(compilerOutput.Messages))
 	assert.Equal(t, plinko.CompileWarning, compilerOutput.Messages[0].CompileMessage)
 	assert.Equal(t, "State 'PublishedOrder' is a state without any triggers (deadend state).", compilerOutput.Messages[0].Message)
+	assert.Equal(t, plinko.MissingInitialStateCode, compilerOutput.Messages[1].Code)
 }
 
 func TestUmlDiagramming(t *testing.T) {
@@ -114,6 +120,22 @@ func TestUmlDiagramming(t *testing.T) {
 	assert.Equal(t, "\n@enduml", string(uml)[len(uml)-8:])
 }
 
+func TestMermaidDiagramming(t *testing.T) {
+	p := CreatePlinkoDefinition()
+	p.InitialState(NewOrder)
+
+	p.Configure(NewOrder).
+		Permit("Submit", "PublishedOrder")
+
+	p.Configure("PublishedOrder").
+		Terminal()
+
+	mermaid, err := p.RenderMermaid()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "stateDiagram-v2\n    [*] --> NewOrder\n    NewOrder --> PublishedOrder : Submit\n    PublishedOrder --> [*]\n", string(mermaid))
+}
+
 func TestPlinkoDefinition(t *testing.T) {
 	stateMap := make(map[plinko.State]*runtime.InternalStateDefinition)
 	plinko := runtime.PlinkoDefinition{
@@ -493,9 +515,14 @@ func TestStateMachineErrorHandling(t *testing.T) {
 	assert.NotNil(t, p1)
 	assert.NotNil(t, e)
 	assert.Equal(t, RejectedOrder, transitionInfo.GetDestination())
-	assert.Equal(t, errors.New("not-wizard"), e)
 
-	assert.Equal(t, 2, transitionVisitCount)
+	var re *plinkoerror.PlinkoRedirectError
+	require.True(t, errors.As(e, &re))
+	assert.Equal(t, RejectedOrder, re.GetDestination())
+	assert.Equal(t, plinko.State("PublishedOrder"), re.OriginalDestination)
+	assert.Equal(t, errors.New("not-wizard"), errors.Unwrap(e))
+
+	assert.Equal(t, 3, transitionVisitCount)
 
 }
 
@@ -535,3 +562,105 @@ func TestStateMachinePanicSuppression(t *testing.T) {
 	require.Error(t, e)
 	assert.Contains(t, e.Error(), "overridden function name")
 }
+
+type mutableTestPayload struct {
+	testPayload
+}
+
+func (p *mutableTestPayload) SetState(state plinko.State) {
+	p.state = state
+}
+
+func TestStateUpdateDefinitionOption(t *testing.T) {
+	var entryState plinko.State
+	p := CreatePlinkoDefinition(definition.WithStateUpdate(plinko.UpdateStateBeforeEntry))
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		OnEntry(func(_ context.Context, pp plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+			entryState = pp.GetState()
+			return pp, nil
+		})
+
+	psm := p.Compile().StateMachine
+
+	payload := &mutableTestPayload{testPayload{state: Created}}
+	_, err := psm.Fire(context.TODO(), payload, Open)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Opened, entryState)
+	assert.Equal(t, Opened, payload.GetState())
+}
+
+func TestOperationRetryOption(t *testing.T) {
+	attempts := 0
+	var handledErr error
+	p := CreatePlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		OnEntry(func(_ context.Context, pp plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+			attempts++
+			return pp, errors.New("store unavailable")
+		}, operation.WithName("NotifyStore"), operation.WithTimeout(time.Second), operation.WithRetry(3, operation.ConstantBackoff(time.Millisecond), nil)).
+		OnError(func(_ context.Context, pp plinko.Payload, _ plinko.ModifiableTransitionInfo, e error) (plinko.Payload, error) {
+			handledErr = e
+			return pp, nil
+		})
+
+	psm := p.Compile().StateMachine
+
+	_, err := psm.Fire(context.TODO(), &testPayload{state: Created}, Open)
+
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, err, handledErr)
+
+	var re *plinkoerror.PlinkoRetryError
+	if assert.True(t, errors.As(err, &re)) {
+		assert.True(t, re.Exhausted())
+		assert.Equal(t, "NotifyStore", re.StepName)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := operation.ExponentialBackoff(100 * time.Millisecond)
+
+	assert.Equal(t, 100*time.Millisecond, backoff(2))
+	assert.Equal(t, 200*time.Millisecond, backoff(3))
+	assert.Equal(t, 800*time.Millisecond, backoff(5))
+	assert.Equal(t, time.Duration(math.MaxInt64), backoff(100))
+	assert.Equal(t, time.Duration(math.MaxInt64), backoff(math.MaxInt32))
+}
+
+func TestOperationCompensationOption(t *testing.T) {
+	var steps []string
+	p := CreatePlinkoDefinition()
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		OnEntry(func(_ context.Context, pp plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+			steps = append(steps, "ReserveInventory")
+			return pp, nil
+		}, operation.WithCompensation(func(_ context.Context, pp plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+			steps = append(steps, "ReleaseInventory")
+			return pp, nil
+		})).
+		OnEntry(entryFunctionForTest).
+		OnError(func(_ context.Context, pp plinko.Payload, _ plinko.ModifiableTransitionInfo, e error) (plinko.Payload, error) {
+			steps = append(steps, "OnError")
+			return pp, nil
+		})
+
+	psm := p.Compile().StateMachine
+
+	_, err := psm.Fire(context.TODO(), &testPayload{state: Created}, Open)
+
+	assert.EqualError(t, err, "misc entry error")
+	assert.Equal(t, []string{"ReserveInventory", "OnError", "ReleaseInventory"}, steps)
+}
@@ -0,0 +1,40 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package definition
+
+import (
+	"github.com/shipt/plinko"
+)
+
+// WithStateUpdate selects when Fire writes the landing state back to payloads implementing
+// plinko.MutablePayload.
+func WithStateUpdate(point plinko.StateUpdatePoint) func(*plinko.DefinitionConfig) {
+	return func(c *plinko.DefinitionConfig) {
+		c.StateUpdate = point
+	}
+}
+
+// WithMaxAutoTransitions bounds the number of automatic transitions followed by a single Fire.
+func WithMaxAutoTransitions(max int) func(*plinko.DefinitionConfig) {
+	return func(c *plinko.DefinitionConfig) {
+		c.MaxAutoTransitions = max
+	}
+}
+
+// WithWarningsAsErrors makes Compile report every warning as an error.
+func WithWarningsAsErrors() func(*plinko.DefinitionConfig) {
+	return func(c *plinko.DefinitionConfig) {
+		c.WarningsAsErrors = true
+	}
+}
+
+// WithLintRules adds rules that Compile runs over every state.
+func WithLintRules(rules ...plinko.LintRule) func(*plinko.DefinitionConfig) {
+	return func(c *plinko.DefinitionConfig) {
+		c.LintRules = append(c.LintRules, rules...)
+	}
+}
@@ -0,0 +1,320 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/pkg/config"
+	"github.com/shipt/plinko/pkg/config/operation"
+	"github.com/shipt/plinko/pkg/config/state"
+	"github.com/shipt/plinko/plinkoerror"
+	"gopkg.in/yaml.v3"
+)
+
+// Load reads a YAML or JSON document into a definition.  The document lists the states in the order
+// they are configured:
+//
+//	initial: Created
+//	sideEffects: [LogTransition]
+//	states:
+//	  - name: Created
+//	    description: A new order
+//	    onEntry: [OnNewOrderEntry]
+//	    onError: [RedirectOnFailure]
+//	    permits:
+//	      - trigger: Cancel
+//	        destination: Canceled
+//	        guard: IsOrderCancellable
+//	    ignore: [Ping]
+//	  - name: Canceled
+//	    terminal: true
+//
+// A state also accepts parent, to declare it a substate, and onExit.  Operation, guard, error operation
+// and side effect names are resolved through the registry.  When the document can't be mapped the error
+// is a PlinkoCompileError listing every problem found, each with its line and column.
+func Load(r io.Reader, registry plinko.Registry, opts ...plinko.DefinitionOption) (plinko.PlinkoDefinition, error) {
+	var root yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&root); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = errors.New("the document is empty")
+		}
+		return nil, plinkoerror.CreatePlinkoCompileError([]plinko.CompilerMessage{{
+			CompileMessage: plinko.CompileError,
+			Message:        fmt.Sprintf("Document can't be parsed: %s.", err),
+			Code:           plinko.InvalidDocumentCode,
+		}})
+	}
+
+	l := loader{
+		p:        config.CreatePlinkoDefinition(opts...),
+		registry: registry,
+	}
+	l.document(root.Content[0])
+
+	if len(l.messages) > 0 {
+		return nil, plinkoerror.CreatePlinkoCompileError(l.messages)
+	}
+
+	return l.p, nil
+}
+
+type loader struct {
+	p        plinko.PlinkoDefinition
+	registry plinko.Registry
+	messages []plinko.CompilerMessage
+}
+
+func (l *loader) document(n *yaml.Node) {
+	l.fields(n, "document", func(key string, value *yaml.Node) {
+		switch key {
+		case "initial":
+			if initial, ok := l.scalar(value, key); ok {
+				l.try(value, func() { l.p.InitialState(plinko.State(initial)) })
+			}
+		case "sideEffects":
+			for _, name := range l.names(value, key) {
+				if fn := l.registry.SideEffects[name.Value]; fn != nil {
+					l.p.SideEffect(fn)
+				} else {
+					l.unknown(name, "Side effect '%s' is not in the registry.", name.Value)
+				}
+			}
+		case "states":
+			if l.sequence(value, key) {
+				for _, s := range value.Content {
+					l.state(s)
+				}
+			}
+		default:
+			l.invalid(value, "Unknown field '%s' in the document.", key)
+		}
+	})
+}
+
+// state configures the state first, so the remaining fields can be applied in any order.
+func (l *loader) state(n *yaml.Node) {
+	fields := make(map[string]*yaml.Node)
+	l.fields(n, "state", func(key string, value *yaml.Node) {
+		fields[key] = value
+	})
+
+	nameNode, ok := fields["name"]
+	if !ok {
+		if n.Kind == yaml.MappingNode {
+			l.invalid(n, "A state has no name.")
+		}
+		return
+	}
+	name, ok := l.scalar(nameNode, "name")
+	if !ok {
+		return
+	}
+
+	var opts []plinko.StateOption
+	if value, ok := fields["description"]; ok {
+		if description, ok := l.scalar(value, "description"); ok {
+			opts = append(opts, state.WithDescription(description))
+		}
+	}
+
+	s := plinko.State(name)
+	var sd plinko.StateDefinition
+	if !l.try(nameNode, func() { sd = l.p.Configure(s, opts...) }) {
+		return
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i].Value, n.Content[i+1]
+		switch key {
+		case "name", "description":
+		case "parent":
+			if parent, ok := l.scalar(value, key); ok {
+				l.try(value, func() { sd.SubstateOf(plinko.State(parent)) })
+			}
+		case "terminal":
+			var terminal bool
+			if err := value.Decode(&terminal); err != nil {
+				l.invalid(value, "Field 'terminal' of State '%s' must be true or false.", s)
+			} else if terminal {
+				sd.Terminal()
+			}
+		case "onEntry":
+			for _, ref := range l.names(value, key) {
+				if op := l.operation(ref, s); op != nil {
+					sd.OnEntry(op, operation.WithName(ref.Value))
+				}
+			}
+		case "onExit":
+			for _, ref := range l.names(value, key) {
+				if op := l.operation(ref, s); op != nil {
+					sd.OnExit(op, operation.WithName(ref.Value))
+				}
+			}
+		case "onError":
+			for _, ref := range l.names(value, key) {
+				if op := l.registry.ErrorOperations[ref.Value]; op != nil {
+					sd.OnError(op, operation.WithName(ref.Value))
+				} else {
+					l.unknown(ref, "Error operation '%s' of State '%s' is not in the registry.", ref.Value, s)
+				}
+			}
+		case "permits":
+			if l.sequence(value, key) {
+				for _, permit := range value.Content {
+					l.permit(sd, s, permit)
+				}
+			}
+		case "ignore":
+			for _, trigger := range l.names(value, key) {
+				l.try(trigger, func() { sd.Ignore(plinko.Trigger(trigger.Value)) })
+			}
+		default:
+			l.invalid(n.Content[i], "Unknown field '%s' in State '%s'.", key, s)
+		}
+	}
+}
+
+func (l *loader) permit(sd plinko.StateDefinition, s plinko.State, n *yaml.Node) {
+	var trigger, destination, guard *yaml.Node
+	l.fields(n, "permit", func(key string, value *yaml.Node) {
+		switch key {
+		case "trigger":
+			trigger = value
+		case "destination":
+			destination = value
+		case "guard":
+			guard = value
+		default:
+			l.invalid(value, "Unknown field '%s' in a permit of State '%s'.", key, s)
+		}
+	})
+
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+	if trigger == nil || destination == nil {
+		l.invalid(n, "A permit of State '%s' needs a trigger and a destination.", s)
+		return
+	}
+
+	t, ok := l.scalar(trigger, "trigger")
+	if !ok {
+		return
+	}
+	d, ok := l.scalar(destination, "destination")
+	if !ok {
+		return
+	}
+
+	if guard == nil {
+		l.try(trigger, func() { sd.Permit(plinko.Trigger(t), plinko.State(d)) })
+		return
+	}
+
+	g, ok := l.scalar(guard, "guard")
+	if !ok {
+		return
+	}
+	predicate := l.registry.Predicates[g]
+	if predicate == nil {
+		l.unknown(guard, "Guard '%s' of State '%s' is not in the registry.", g, s)
+		return
+	}
+	l.try(trigger, func() { sd.PermitIf(predicate, plinko.Trigger(t), plinko.State(d), operation.WithName(g)) })
+}
+
+func (l *loader) operation(ref *yaml.Node, s plinko.State) plinko.Operation {
+	op := l.registry.Operations[ref.Value]
+	if op == nil {
+		l.unknown(ref, "Operation '%s' of State '%s' is not in the registry.", ref.Value, s)
+	}
+
+	return op
+}
+
+// fields calls field for each key of a mapping, in document order.
+func (l *loader) fields(n *yaml.Node, what string, field func(key string, value *yaml.Node)) {
+	if n.Kind != yaml.MappingNode {
+		l.invalid(n, "A %s must be a mapping.", what)
+		return
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		field(n.Content[i].Value, n.Content[i+1])
+	}
+}
+
+func (l *loader) scalar(n *yaml.Node, field string) (string, bool) {
+	if n.Kind != yaml.ScalarNode || n.Value == "" {
+		l.invalid(n, "Field '%s' must be a non-empty string.", field)
+		return "", false
+	}
+
+	return n.Value, true
+}
+
+func (l *loader) sequence(n *yaml.Node, field string) bool {
+	if n.Kind != yaml.SequenceNode {
+		l.invalid(n, "Field '%s' must be a list.", field)
+		return false
+	}
+
+	return true
+}
+
+// names returns the names of a list field, which may also be given as a single name.
+func (l *loader) names(n *yaml.Node, field string) []*yaml.Node {
+	if n.Kind == yaml.ScalarNode {
+		n = &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{n}}
+	}
+	if !l.sequence(n, field) {
+		return nil
+	}
+
+	var names []*yaml.Node
+	for _, name := range n.Content {
+		if _, ok := l.scalar(name, field); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// try runs a configuration call, reporting the panic raised for an invalid configuration as a message.
+func (l *loader) try(n *yaml.Node, configure func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.invalid(n, "%v", r)
+			ok = false
+		}
+	}()
+
+	configure()
+
+	return true
+}
+
+func (l *loader) invalid(n *yaml.Node, format string, args ...interface{}) {
+	l.report(n, plinko.InvalidDocumentCode, format, args...)
+}
+
+func (l *loader) unknown(n *yaml.Node, format string, args ...interface{}) {
+	l.report(n, plinko.UnknownReferenceCode, format, args...)
+}
+
+func (l *loader) report(n *yaml.Node, code plinko.CompilerMessageCode, format string, args ...interface{}) {
+	l.messages = append(l.messages, plinko.CompilerMessage{
+		CompileMessage: plinko.CompileError,
+		Message:        fmt.Sprintf("Line %d, column %d: %s", n.Line, n.Column, fmt.Sprintf(format, args...)),
+		Code:           code,
+	})
+}
@@ -0,0 +1,191 @@
+package loader_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/pkg/config/loader"
+	"github.com/shipt/plinko/plinkoerror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const Created plinko.State = "Created"
+const Opened plinko.State = "Opened"
+const Canceled plinko.State = "Canceled"
+
+type testPayload struct {
+	state plinko.State
+	steps []string
+}
+
+func (p *testPayload) GetState() plinko.State {
+	return p.state
+}
+
+func record(step string) plinko.Operation {
+	return func(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+		tp := p.(*testPayload)
+		tp.steps = append(tp.steps, step)
+		return p, nil
+	}
+}
+
+func newRegistry(actions *[]plinko.StateAction) plinko.Registry {
+	return plinko.Registry{
+		Operations: map[string]plinko.Operation{
+			"OnNewOrderExit": record("exit created"),
+			"OnOpenedEntry":  record("enter opened"),
+		},
+		Predicates: map[string]plinko.Predicate{
+			"IsOrderCancellable": func(context.Context, plinko.Payload, plinko.TransitionInfo) error {
+				return errors.New("order already shipped")
+			},
+		},
+		ErrorOperations: map[string]plinko.ErrorOperation{
+			"RedirectOnFailure": func(_ context.Context, p plinko.Payload, _ plinko.ModifiableTransitionInfo, err error) (plinko.Payload, error) {
+				return p, err
+			},
+		},
+		SideEffects: map[string]plinko.SideEffect{
+			"LogTransition": func(_ context.Context, action plinko.StateAction, _ plinko.Payload, _ plinko.TransitionInfo, _ int64) {
+				*actions = append(*actions, action)
+			},
+		},
+	}
+}
+
+const orderYAML = `
+initial: Created
+sideEffects: [LogTransition]
+states:
+  - name: Created
+    description: A new order
+    onExit: OnNewOrderExit
+    onError: [RedirectOnFailure]
+    permits:
+      - trigger: Open
+        destination: Opened
+      - trigger: Cancel
+        destination: Canceled
+        guard: IsOrderCancellable
+    ignore: [Ping]
+  - name: Opened
+    onEntry: [OnOpenedEntry]
+    terminal: true
+  - name: Canceled
+    terminal: true
+`
+
+func TestLoadYAML(t *testing.T) {
+	var actions []plinko.StateAction
+	p, err := loader.Load(strings.NewReader(orderYAML), newRegistry(&actions))
+	require.Nil(t, err)
+
+	co := p.Compile()
+	assert.Equal(t, []plinko.CompilerMessage{{
+		CompileMessage: plinko.CompileWarning,
+		Message:        "Trigger 'Ping' is referenced but not permitted by any state.",
+		Code:           plinko.UnusedTriggerCode,
+	}}, co.Messages)
+
+	// guards are named after their registry key, not the function registered under it
+	var guards []string
+	p.Describe(func(info plinko.StateInfo) {
+		for _, permit := range info.Permits {
+			if permit.Guarded {
+				guards = append(guards, permit.GuardName)
+			}
+		}
+	})
+	assert.Equal(t, []string{"IsOrderCancellable"}, guards)
+
+	payload := &testPayload{state: Created}
+	err = co.StateMachine.CanFire(context.TODO(), payload, "Cancel")
+	assert.NotNil(t, err)
+
+	_, err = co.StateMachine.Fire(context.TODO(), payload, "Ping")
+	assert.Nil(t, err)
+
+	_, err = co.StateMachine.Fire(context.TODO(), payload, "Open")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"exit created", "enter opened"}, payload.steps)
+	assert.Equal(t, []plinko.StateAction{plinko.BeforeTransition, plinko.BetweenStates, plinko.AfterTransition}, actions)
+}
+
+func TestLoadJSON(t *testing.T) {
+	var actions []plinko.StateAction
+	p, err := loader.Load(strings.NewReader(`{
+  "states": [
+    {"name": "Created", "permits": [{"trigger": "Open", "destination": "Opened"}]},
+    {"name": "Opened", "parent": "Active", "onEntry": ["OnOpenedEntry"]},
+    {"name": "Active", "terminal": true}
+  ]
+}`), newRegistry(&actions))
+	require.Nil(t, err)
+
+	uml, err := p.RenderUml()
+	assert.Nil(t, err)
+	assert.Contains(t, string(uml), "state Active {\n  state Opened\n}\n")
+	assert.Contains(t, string(uml), "Created --> Opened : Open\n")
+}
+
+func TestLoadReportsProblemsWithPositions(t *testing.T) {
+	var actions []plinko.StateAction
+	p, err := loader.Load(strings.NewReader(`sideEffects: [Audit]
+states:
+  - name: Created
+    onEntry: [SendEmail]
+    colour: blue
+    permits:
+      - trigger: Cancel
+        destination: Canceled
+        guard: IsPaid
+      - trigger: Open
+  - name: Created
+  - description: no name
+`), newRegistry(&actions))
+
+	assert.Nil(t, p)
+	var ce *plinkoerror.PlinkoCompileError
+	require.True(t, errors.As(err, &ce))
+	assert.Equal(t, []plinko.CompilerMessage{
+		{CompileMessage: plinko.CompileError, Message: "Line 1, column 15: Side effect 'Audit' is not in the registry.", Code: plinko.UnknownReferenceCode},
+		{CompileMessage: plinko.CompileError, Message: "Line 4, column 15: Operation 'SendEmail' of State 'Created' is not in the registry.", Code: plinko.UnknownReferenceCode},
+		{CompileMessage: plinko.CompileError, Message: "Line 5, column 5: Unknown field 'colour' in State 'Created'.", Code: plinko.InvalidDocumentCode},
+		{CompileMessage: plinko.CompileError, Message: "Line 9, column 16: Guard 'IsPaid' of State 'Created' is not in the registry.", Code: plinko.UnknownReferenceCode},
+		{CompileMessage: plinko.CompileError, Message: "Line 10, column 9: A permit of State 'Created' needs a trigger and a destination.", Code: plinko.InvalidDocumentCode},
+		{CompileMessage: plinko.CompileError, Message: "Line 11, column 11: State: Created - has already been defined, plinko configuration invalid.", Code: plinko.InvalidDocumentCode},
+		{CompileMessage: plinko.CompileError, Message: "Line 12, column 5: A state has no name.", Code: plinko.InvalidDocumentCode},
+	}, ce.Messages)
+}
+
+func TestLoadReportsSecondInitialState(t *testing.T) {
+	p, err := loader.Load(strings.NewReader(`initial: Created
+initial: Opened
+states:
+  - name: Created
+`), plinko.Registry{})
+
+	assert.Nil(t, p)
+	var ce *plinkoerror.PlinkoCompileError
+	require.True(t, errors.As(err, &ce))
+	assert.Len(t, ce.Messages, 1)
+	assert.Equal(t, plinko.InvalidDocumentCode, ce.Messages[0].Code)
+	assert.Contains(t, ce.Messages[0].Message, "Line 2, column 10: ")
+}
+
+func TestLoadMalformedDocument(t *testing.T) {
+	_, err := loader.Load(strings.NewReader("states: [\n"), plinko.Registry{})
+
+	var ce *plinkoerror.PlinkoCompileError
+	require.True(t, errors.As(err, &ce))
+	assert.Equal(t, plinko.InvalidDocumentCode, ce.Messages[0].Code)
+	assert.Contains(t, ce.Messages[0].Message, "line")
+
+	_, err = loader.Load(strings.NewReader(""), plinko.Registry{})
+	assert.EqualError(t, err, "1 compile error(s): Document can't be parsed: the document is empty.")
+}
@@ -7,6 +7,9 @@
 package operation
 
 import (
+	"math"
+	"time"
+
 	"github.com/shipt/plinko"
 )
 
@@ -15,3 +18,59 @@ func WithName(name string) func(*plinko.OperationConfig) {
 		c.Name = name
 	}
 }
+
+// WithTimeout limits each attempt of the operation to d.  When the time is up, the operation's context is
+// canceled and the step fails with context.DeadlineExceeded without waiting for the operation to return.
+func WithTimeout(d time.Duration) func(*plinko.OperationConfig) {
+	return func(c *plinko.OperationConfig) {
+		c.Timeout = d
+	}
+}
+
+// WithRetry runs the operation up to maxAttempts times while it fails with an error accepted by
+// retryable.  A nil backoff retries immediately and a nil retryable retries every error.
+func WithRetry(maxAttempts int, backoff plinko.Backoff, retryable func(error) bool) func(*plinko.OperationConfig) {
+	return func(c *plinko.OperationConfig) {
+		c.Retry = &plinko.RetryPolicy{
+			MaxAttempts: maxAttempts,
+			Backoff:     backoff,
+			Retryable:   retryable,
+		}
+	}
+}
+
+// ConstantBackoff waits d before every retry.
+func ConstantBackoff(d time.Duration) plinko.Backoff {
+	return func(int) time.Duration {
+		return d
+	}
+}
+
+// maxBackoff caps the wait of ExponentialBackoff once doubling would overflow.
+const maxBackoff = time.Duration(math.MaxInt64)
+
+// ExponentialBackoff waits base before the first retry and doubles the wait for each one after it, up to
+// the largest time.Duration.
+func ExponentialBackoff(base time.Duration) plinko.Backoff {
+	return func(attempt int) time.Duration {
+		wait := base
+		for i := 2; i < attempt; i++ {
+			if wait > maxBackoff/2 {
+				return maxBackoff
+			}
+			wait *= 2
+		}
+
+		return wait
+	}
+}
+
+// WithCompensation registers an operation that undoes this one.  When a later step of the same transition
+// fails, in any of the exit and entry chains it runs, the OnError handlers are called and then the
+// compensations of the steps that completed run in reverse order.  When a handler redirects the
+// transition, only the entry steps of the abandoned destination are compensated.
+func WithCompensation(undo plinko.Operation) func(*plinko.OperationConfig) {
+	return func(c *plinko.OperationConfig) {
+		c.Compensation = undo
+	}
+}
@@ -0,0 +1,277 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package scxml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/pkg/config"
+	"github.com/shipt/plinko/pkg/config/operation"
+	"github.com/shipt/plinko/pkg/config/state"
+	"github.com/shipt/plinko/plinkoerror"
+)
+
+type document struct {
+	XMLName xml.Name `xml:"scxml"`
+	Initial string   `xml:"initial,attr"`
+	States  []node   `xml:",any"`
+}
+
+type node struct {
+	XMLName     xml.Name
+	ID          string       `xml:"id,attr"`
+	Description string       `xml:"https://github.com/shipt/plinko description,attr"`
+	OnEntry     []block      `xml:"onentry"`
+	OnExit      []block      `xml:"onexit"`
+	OnError     []block      `xml:"https://github.com/shipt/plinko onerror"`
+	Transitions []transition `xml:"transition"`
+	States      []node       `xml:",any"`
+}
+
+type block struct {
+	Operations []reference `xml:"https://github.com/shipt/plinko operation"`
+}
+
+type transition struct {
+	Event      string      `xml:"event,attr"`
+	Target     string      `xml:"target,attr"`
+	Cond       string      `xml:"cond,attr"`
+	Selector   string      `xml:"https://github.com/shipt/plinko selector,attr"`
+	Targets    string      `xml:"https://github.com/shipt/plinko targets,attr"`
+	Operations []reference `xml:"https://github.com/shipt/plinko operation"`
+}
+
+type reference struct {
+	Name    string `xml:"name,attr"`
+	Trigger string `xml:"https://github.com/shipt/plinko trigger,attr"`
+}
+
+// Load reads an SCXML document into a definition.  Each state or final element is configured as a
+// state, nested states become substates and final states are declared terminal.  Transitions map to
+// permits: without an event to an automatic transition, with a plinko:selector attribute to a dynamic
+// transition to the states listed in plinko:targets, without a target to an internal transition when
+// they hold an operation and to an ignored trigger otherwise.  The names of cond and plinko:selector
+// attributes and of plinko:operation elements in onentry, onexit, plinko:onerror and transitions are
+// resolved through the registry.  An onentry or onexit operation with a plinko:trigger attribute only
+// runs on that trigger, as with OnTriggerEntry and OnTriggerExit.
+//
+// When the document can't be mapped the error is a PlinkoCompileError listing every problem found.
+func Load(r io.Reader, registry plinko.Registry, opts ...plinko.DefinitionOption) (plinko.PlinkoDefinition, error) {
+	var doc document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, plinkoerror.CreatePlinkoCompileError([]plinko.CompilerMessage{
+			invalid("SCXML document can't be parsed: %s.", err),
+		})
+	}
+
+	l := loader{
+		p:        config.CreatePlinkoDefinition(opts...),
+		registry: registry,
+	}
+
+	if doc.Initial != "" {
+		l.p.InitialState(plinko.State(doc.Initial))
+	}
+
+	for _, n := range doc.States {
+		l.state(n, "")
+	}
+
+	if len(l.messages) > 0 {
+		return nil, plinkoerror.CreatePlinkoCompileError(l.messages)
+	}
+
+	return l.p, nil
+}
+
+type loader struct {
+	p        plinko.PlinkoDefinition
+	registry plinko.Registry
+	messages []plinko.CompilerMessage
+}
+
+func (l *loader) state(n node, parent plinko.State) {
+	switch n.XMLName.Local {
+	case "state", "final":
+	case "parallel":
+		l.messages = append(l.messages, invalid("State '%s' is a parallel state, which is not supported.", n.ID))
+		return
+	default:
+		// datamodel, script and other elements don't describe states
+		return
+	}
+
+	if n.ID == "" {
+		l.messages = append(l.messages, invalid("A %s element has no id.", n.XMLName.Local))
+		return
+	}
+
+	s := plinko.State(n.ID)
+	var sd plinko.StateDefinition
+	if !l.try(func() { sd = l.p.Configure(s, state.WithDescription(n.Description)) }) {
+		return
+	}
+
+	if parent != "" {
+		sd.SubstateOf(parent)
+	}
+	if n.XMLName.Local == "final" {
+		sd.Terminal()
+	}
+
+	for _, b := range n.OnEntry {
+		for _, ref := range b.Operations {
+			op := l.operation(s, ref.Name)
+			switch {
+			case op == nil:
+			case ref.Trigger != "":
+				sd.OnTriggerEntry(plinko.Trigger(ref.Trigger), op, operation.WithName(ref.Name))
+			default:
+				sd.OnEntry(op, operation.WithName(ref.Name))
+			}
+		}
+	}
+	for _, b := range n.OnExit {
+		for _, ref := range b.Operations {
+			op := l.operation(s, ref.Name)
+			switch {
+			case op == nil:
+			case ref.Trigger != "":
+				sd.OnTriggerExit(plinko.Trigger(ref.Trigger), op, operation.WithName(ref.Name))
+			default:
+				sd.OnExit(op, operation.WithName(ref.Name))
+			}
+		}
+	}
+
+	for _, b := range n.OnError {
+		for _, ref := range b.Operations {
+			if op := l.registry.ErrorOperations[ref.Name]; op != nil {
+				sd.OnError(op, operation.WithName(ref.Name))
+			} else {
+				l.messages = append(l.messages, unknown("Error operation '%s' of State '%s' is not in the registry.", ref.Name, s))
+			}
+		}
+	}
+
+	for _, t := range n.Transitions {
+		l.transition(sd, s, t)
+	}
+
+	for _, child := range n.States {
+		l.state(child, s)
+	}
+}
+
+func (l *loader) transition(sd plinko.StateDefinition, s plinko.State, t transition) {
+	var predicate plinko.Predicate
+	if t.Cond != "" {
+		if predicate = l.registry.Predicates[t.Cond]; predicate == nil {
+			l.messages = append(l.messages, unknown("Guard '%s' of State '%s' is not in the registry.", t.Cond, s))
+			return
+		}
+	}
+
+	trigger := plinko.Trigger(t.Event)
+	targets := strings.Fields(t.Target)
+
+	if t.Selector != "" {
+		l.dynamicTransition(sd, s, t, predicate)
+		return
+	}
+
+	switch {
+	case len(targets) > 1:
+		l.messages = append(l.messages, invalid("Transition '%s' of State '%s' has several targets, which is not supported.", t.Event, s))
+	case trigger == "" && len(targets) == 0:
+		l.messages = append(l.messages, invalid("A transition of State '%s' has neither an event nor a target.", s))
+	case trigger == "":
+		if predicate != nil {
+			l.try(func() { sd.PermitAutoIf(predicate, plinko.State(targets[0]), operation.WithName(t.Cond)) })
+		} else {
+			l.try(func() { sd.PermitAuto(plinko.State(targets[0])) })
+		}
+	case len(targets) == 0 && len(t.Operations) == 0:
+		l.try(func() { sd.Ignore(trigger) })
+	case len(targets) == 0:
+		if len(t.Operations) > 1 || predicate != nil {
+			l.messages = append(l.messages, invalid("Internal transition '%s' of State '%s' must have a single operation and no guard.", t.Event, s))
+			return
+		}
+		if op := l.operation(s, t.Operations[0].Name); op != nil {
+			l.try(func() { sd.InternalTransition(trigger, op, operation.WithName(t.Operations[0].Name)) })
+		}
+	case predicate != nil:
+		l.try(func() { sd.PermitIf(predicate, trigger, plinko.State(targets[0]), operation.WithName(t.Cond)) })
+	default:
+		l.try(func() { sd.Permit(trigger, plinko.State(targets[0])) })
+	}
+}
+
+func (l *loader) dynamicTransition(sd plinko.StateDefinition, s plinko.State, t transition, predicate plinko.Predicate) {
+	if t.Event == "" || t.Target != "" || predicate != nil || len(t.Operations) > 0 {
+		l.messages = append(l.messages, invalid("Dynamic transition '%s' of State '%s' must have an event and no target, guard or operation.", t.Event, s))
+		return
+	}
+
+	selector := l.registry.Selectors[t.Selector]
+	if selector == nil {
+		l.messages = append(l.messages, unknown("Selector '%s' of State '%s' is not in the registry.", t.Selector, s))
+		return
+	}
+
+	var destinations []plinko.State
+	for _, target := range strings.Fields(t.Targets) {
+		destinations = append(destinations, plinko.State(target))
+	}
+	l.try(func() {
+		sd.PermitDynamic(plinko.Trigger(t.Event), selector, destinations, operation.WithName(t.Selector))
+	})
+}
+
+func (l *loader) operation(s plinko.State, name string) plinko.Operation {
+	op := l.registry.Operations[name]
+	if op == nil {
+		l.messages = append(l.messages, unknown("Operation '%s' of State '%s' is not in the registry.", name, s))
+	}
+
+	return op
+}
+
+// try runs a configuration call, reporting the panic raised for an invalid configuration as a message.
+func (l *loader) try(configure func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.messages = append(l.messages, invalid("%v", r))
+			ok = false
+		}
+	}()
+
+	configure()
+
+	return true
+}
+
+func invalid(format string, args ...interface{}) plinko.CompilerMessage {
+	return plinko.CompilerMessage{
+		CompileMessage: plinko.CompileError,
+		Message:        fmt.Sprintf(format, args...),
+		Code:           plinko.InvalidDocumentCode,
+	}
+}
+
+func unknown(format string, args ...interface{}) plinko.CompilerMessage {
+	return plinko.CompilerMessage{
+		CompileMessage: plinko.CompileError,
+		Message:        fmt.Sprintf(format, args...),
+		Code:           plinko.UnknownReferenceCode,
+	}
+}
@@ -0,0 +1,251 @@
+package scxml_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/pkg/config"
+	"github.com/shipt/plinko/pkg/config/operation"
+	"github.com/shipt/plinko/pkg/config/scxml"
+	"github.com/shipt/plinko/pkg/config/state"
+	"github.com/shipt/plinko/pkg/render"
+	"github.com/shipt/plinko/plinkoerror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const Created plinko.State = "Created"
+const Active plinko.State = "Active"
+const Opened plinko.State = "Opened"
+const Canceled plinko.State = "Canceled"
+
+const Open plinko.Trigger = "Open"
+const Cancel plinko.Trigger = "Cancel"
+const Note plinko.Trigger = "Note"
+const Ping plinko.Trigger = "Ping"
+const Split plinko.Trigger = "Split"
+
+func OnNewOrderEntry(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+	return p, nil
+}
+
+func RecordNote(_ context.Context, p plinko.Payload, _ plinko.TransitionInfo) (plinko.Payload, error) {
+	return p, nil
+}
+
+func IsCancellable(_ context.Context, _ plinko.Payload, _ plinko.TransitionInfo) error {
+	return nil
+}
+
+func RedirectOnFailure(_ context.Context, p plinko.Payload, _ plinko.ModifiableTransitionInfo, err error) (plinko.Payload, error) {
+	return p, err
+}
+
+func ChooseDestination(_ context.Context, _ plinko.Payload) (plinko.State, error) {
+	return Opened, nil
+}
+
+var registry = plinko.Registry{
+	Operations: map[string]plinko.Operation{
+		"OnNewOrderEntry": OnNewOrderEntry,
+		"RecordNote":      RecordNote,
+	},
+	Predicates: map[string]plinko.Predicate{
+		"IsCancellable": IsCancellable,
+	},
+	ErrorOperations: map[string]plinko.ErrorOperation{
+		"orders.RedirectOnFailure": RedirectOnFailure,
+	},
+	Selectors: map[string]plinko.DestinationSelector{
+		"orders.ChooseDestination": ChooseDestination,
+	},
+}
+
+func orderDefinition() plinko.PlinkoDefinition {
+	p := config.CreatePlinkoDefinition()
+	p.InitialState(Created)
+
+	p.Configure(Created, state.WithDescription("A new order")).
+		OnEntry(OnNewOrderEntry).
+		Permit(Open, Opened).
+		PermitIf(IsCancellable, Cancel, Canceled).
+		InternalTransition(Note, RecordNote, operation.WithName("RecordNote")).
+		Ignore(Ping)
+
+	p.Configure(Active).
+		Permit(Cancel, Canceled)
+
+	p.Configure(Opened).
+		SubstateOf(Active)
+
+	p.Configure(Canceled).
+		Terminal()
+
+	return p
+}
+
+func renderSCXML(t *testing.T, p plinko.PlinkoDefinition) string {
+	buf := bytes.NewBufferString("")
+	require.Nil(t, p.Render(render.NewSCXML(buf)))
+
+	return buf.String()
+}
+
+func TestRenderSCXML(t *testing.T) {
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<scxml xmlns="http://www.w3.org/2005/07/scxml" xmlns:plinko="https://github.com/shipt/plinko" version="1.0" initial="Created">
+  <state id="Created" plinko:description="A new order">
+    <onentry>
+      <plinko:operation name="OnNewOrderEntry"/>
+    </onentry>
+    <transition event="Open" target="Opened"/>
+    <transition event="Cancel" cond="IsCancellable" target="Canceled"/>
+    <transition event="Note" type="internal">
+      <plinko:operation name="RecordNote"/>
+    </transition>
+    <transition event="Ping"/>
+  </state>
+  <state id="Active">
+    <transition event="Cancel" target="Canceled"/>
+    <state id="Opened">
+    </state>
+  </state>
+  <final id="Canceled">
+  </final>
+</scxml>
+`, renderSCXML(t, orderDefinition()))
+}
+
+func TestLoadRoundTrip(t *testing.T) {
+	document := renderSCXML(t, orderDefinition())
+
+	p, err := scxml.Load(strings.NewReader(document), registry)
+
+	require.Nil(t, err)
+	assert.Equal(t, document, renderSCXML(t, p))
+	assert.Equal(t, orderDefinition().Compile().Fingerprint, p.Compile().Fingerprint)
+}
+
+func TestLoadAutomaticTransition(t *testing.T) {
+	p, err := scxml.Load(strings.NewReader(`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" initial="Created">
+  <state id="Created">
+    <transition target="Opened"/>
+  </state>
+  <final id="Opened"/>
+</scxml>`), registry)
+
+	require.Nil(t, err)
+	assert.Empty(t, p.Compile().Messages)
+	assert.Contains(t, renderSCXML(t, p), `<transition target="Opened"/>`)
+}
+
+func TestDynamicTransitionAndErrorHandlersRoundTrip(t *testing.T) {
+	p := config.CreatePlinkoDefinition()
+	p.InitialState(Created)
+
+	p.Configure(Created).
+		OnError(RedirectOnFailure, operation.WithName("orders.RedirectOnFailure")).
+		PermitDynamic(Split, ChooseDestination, []plinko.State{Opened, Canceled}, operation.WithName("orders.ChooseDestination"))
+
+	p.Configure(Opened).
+		Permit(Cancel, Canceled)
+
+	p.Configure(Canceled).
+		Terminal()
+
+	document := renderSCXML(t, p)
+	assert.Contains(t, document, `<plinko:onerror>
+      <plinko:operation name="orders.RedirectOnFailure"/>
+    </plinko:onerror>
+    <transition event="Split" plinko:selector="orders.ChooseDestination" plinko:targets="Opened Canceled"/>`)
+
+	loaded, err := scxml.Load(strings.NewReader(document), registry)
+
+	require.Nil(t, err)
+	assert.Equal(t, document, renderSCXML(t, loaded))
+	assert.Equal(t, p.Compile().Fingerprint, loaded.Compile().Fingerprint)
+
+	_, err = scxml.Load(strings.NewReader(`<scxml xmlns="http://www.w3.org/2005/07/scxml" xmlns:plinko="https://github.com/shipt/plinko" version="1.0">
+  <state id="Created">
+    <plinko:onerror><plinko:operation name="Retry"/></plinko:onerror>
+    <transition event="Split" plinko:selector="Pick" plinko:targets="Opened Canceled"/>
+    <transition event="Merge" plinko:selector="ChooseDestination" target="Opened"/>
+  </state>
+</scxml>`), registry)
+
+	var ce *plinkoerror.PlinkoCompileError
+	require.True(t, errors.As(err, &ce))
+	assert.Equal(t, []plinko.CompilerMessage{
+		{CompileMessage: plinko.CompileError, Message: "Error operation 'Retry' of State 'Created' is not in the registry.", Code: plinko.UnknownReferenceCode},
+		{CompileMessage: plinko.CompileError, Message: "Selector 'Pick' of State 'Created' is not in the registry.", Code: plinko.UnknownReferenceCode},
+		{CompileMessage: plinko.CompileError, Message: "Dynamic transition 'Merge' of State 'Created' must have an event and no target, guard or operation.", Code: plinko.InvalidDocumentCode},
+	}, ce.Messages)
+}
+
+func TestTriggerOperationsRoundTrip(t *testing.T) {
+	p := config.CreatePlinkoDefinition()
+	p.InitialState(Created)
+
+	p.Configure(Created).
+		OnTriggerExit(Open, RecordNote, operation.WithName("RecordNote")).
+		Permit(Open, Opened).
+		Permit(Cancel, Canceled)
+
+	p.Configure(Opened).
+		OnEntry(OnNewOrderEntry).
+		OnTriggerEntry(Open, RecordNote, operation.WithName("RecordNote")).
+		Permit(Cancel, Canceled)
+
+	p.Configure(Canceled).
+		Terminal()
+
+	document := renderSCXML(t, p)
+	assert.Contains(t, document, `<onexit>
+      <plinko:operation name="RecordNote" plinko:trigger="Open"/>
+    </onexit>`)
+	assert.Contains(t, document, `<onentry>
+      <plinko:operation name="OnNewOrderEntry"/>
+      <plinko:operation name="RecordNote" plinko:trigger="Open"/>
+    </onentry>`)
+
+	loaded, err := scxml.Load(strings.NewReader(document), registry)
+
+	require.Nil(t, err)
+	assert.Equal(t, document, renderSCXML(t, loaded))
+	assert.Equal(t, p.Compile().Fingerprint, loaded.Compile().Fingerprint)
+}
+
+func TestLoadReportsProblems(t *testing.T) {
+	p, err := scxml.Load(strings.NewReader(`<scxml xmlns="http://www.w3.org/2005/07/scxml" xmlns:plinko="https://github.com/shipt/plinko" version="1.0">
+  <state id="Created">
+    <onentry><plinko:operation name="SendEmail"/></onentry>
+    <transition event="Open" cond="IsPaid" target="Opened"/>
+    <transition event="Split" target="Opened Canceled"/>
+  </state>
+  <state id="Created"/>
+  <parallel id="Shipping"/>
+</scxml>`), registry)
+
+	assert.Nil(t, p)
+	var ce *plinkoerror.PlinkoCompileError
+	require.True(t, errors.As(err, &ce))
+	assert.Equal(t, []plinko.CompilerMessage{
+		{CompileMessage: plinko.CompileError, Message: "Operation 'SendEmail' of State 'Created' is not in the registry.", Code: plinko.UnknownReferenceCode},
+		{CompileMessage: plinko.CompileError, Message: "Guard 'IsPaid' of State 'Created' is not in the registry.", Code: plinko.UnknownReferenceCode},
+		{CompileMessage: plinko.CompileError, Message: "Transition 'Split' of State 'Created' has several targets, which is not supported.", Code: plinko.InvalidDocumentCode},
+		{CompileMessage: plinko.CompileError, Message: "State: Created - has already been defined, plinko configuration invalid.", Code: plinko.InvalidDocumentCode},
+		{CompileMessage: plinko.CompileError, Message: "State 'Shipping' is a parallel state, which is not supported.", Code: plinko.InvalidDocumentCode},
+	}, ce.Messages)
+}
+
+func TestLoadMalformedDocument(t *testing.T) {
+	_, err := scxml.Load(strings.NewReader(`<scxml><state id="Created">`), registry)
+
+	var ce *plinkoerror.PlinkoCompileError
+	require.True(t, errors.As(err, &ce))
+	assert.Equal(t, plinko.InvalidDocumentCode, ce.Messages[0].Code)
+}
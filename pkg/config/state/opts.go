@@ -19,3 +19,10 @@ func WithDescription(description string) func(*plinko.StateConfig) {
 		c.Description = description
 	}
 }
+
+// WithSuppressedRules keeps the lint rules with the given IDs from checking the state.
+func WithSuppressedRules(ids ...plinko.CompilerMessageCode) func(*plinko.StateConfig) {
+	return func(c *plinko.StateConfig) {
+		c.SuppressedRules = append(c.SuppressedRules, ids...)
+	}
+}
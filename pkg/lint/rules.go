@@ -0,0 +1,121 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package lint
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/shipt/plinko"
+)
+
+const (
+	RequireDescriptionID    plinko.CompilerMessageCode = "require-description"
+	RequireGuardedReentryID plinko.CompilerMessageCode = "require-guarded-reentry"
+	RequireErrorHandlerID   plinko.CompilerMessageCode = "require-error-handler"
+	PascalCaseTriggersID    plinko.CompilerMessageCode = "pascal-case-triggers"
+)
+
+var pascalCase = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+
+type rule struct {
+	id    plinko.CompilerMessageCode
+	check func(plinko.StateInfo) []plinko.CompilerMessage
+}
+
+func (r rule) ID() plinko.CompilerMessageCode {
+	return r.id
+}
+
+func (r rule) Check(info plinko.StateInfo) []plinko.CompilerMessage {
+	return r.check(info)
+}
+
+// New creates a lint rule from a check function.  Compile stamps the ID on every message the check returns.
+func New(id plinko.CompilerMessageCode, check func(plinko.StateInfo) []plinko.CompilerMessage) plinko.LintRule {
+	return rule{id: id, check: check}
+}
+
+func warning(format string, args ...interface{}) plinko.CompilerMessage {
+	return plinko.CompilerMessage{
+		CompileMessage: plinko.CompileWarning,
+		Message:        fmt.Sprintf(format, args...),
+	}
+}
+
+// RequireDescription warns about states configured without a description.
+func RequireDescription() plinko.LintRule {
+	return New(RequireDescriptionID, func(info plinko.StateInfo) []plinko.CompilerMessage {
+		if info.Config.Description != "" {
+			return nil
+		}
+
+		return []plinko.CompilerMessage{warning("State '%s' has no description.", info.State)}
+	})
+}
+
+// RequireGuardedReentry warns about reentrant transitions that are not guarded.
+func RequireGuardedReentry() plinko.LintRule {
+	return New(RequireGuardedReentryID, func(info plinko.StateInfo) []plinko.CompilerMessage {
+		var messages []plinko.CompilerMessage
+		for _, permit := range info.Permits {
+			if permit.Reentry && !permit.Guarded {
+				messages = append(messages, warning("State '%s' reenters itself on Trigger '%s' without a guard.", info.State, permit.Trigger))
+			}
+		}
+
+		return messages
+	})
+}
+
+// RequireErrorHandler warns about states without an OnError operation of their own or inherited from a
+// superstate.
+func RequireErrorHandler() plinko.LintRule {
+	return New(RequireErrorHandlerID, func(info plinko.StateInfo) []plinko.CompilerMessage {
+		if len(info.ErrorOperations) > 0 || len(info.InheritedErrorOperations) > 0 {
+			return nil
+		}
+
+		return []plinko.CompilerMessage{warning("State '%s' has no OnError handler.", info.State)}
+	})
+}
+
+// PascalCaseTriggers warns about triggers permitted or ignored by a state whose names are not PascalCase.
+func PascalCaseTriggers() plinko.LintRule {
+	return New(PascalCaseTriggersID, func(info plinko.StateInfo) []plinko.CompilerMessage {
+		var messages []plinko.CompilerMessage
+		seen := make(map[plinko.Trigger]bool)
+		check := func(trigger plinko.Trigger) {
+			if seen[trigger] || pascalCase.MatchString(string(trigger)) {
+				return
+			}
+			seen[trigger] = true
+			messages = append(messages, warning("Trigger '%s' on State '%s' is not PascalCase.", trigger, info.State))
+		}
+
+		for _, permit := range info.Permits {
+			if !permit.Automatic {
+				check(permit.Trigger)
+			}
+		}
+		for _, trigger := range info.Ignored {
+			check(trigger)
+		}
+
+		return messages
+	})
+}
+
+// HouseRules returns every rule in this package.
+func HouseRules() []plinko.LintRule {
+	return []plinko.LintRule{
+		RequireDescription(),
+		RequireGuardedReentry(),
+		RequireErrorHandler(),
+		PascalCaseTriggers(),
+	}
+}
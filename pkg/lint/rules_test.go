@@ -0,0 +1,95 @@
+package lint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/pkg/config"
+	"github.com/shipt/plinko/pkg/config/definition"
+	"github.com/shipt/plinko/pkg/config/state"
+	"github.com/stretchr/testify/assert"
+)
+
+const Created plinko.State = "Created"
+const Opened plinko.State = "Opened"
+const Canceled plinko.State = "Canceled"
+const Active plinko.State = "Active"
+
+const Open plinko.Trigger = "Open"
+const Cancel plinko.Trigger = "cancel"
+const Retry plinko.Trigger = "Retry"
+
+func handleError(_ context.Context, p plinko.Payload, _ plinko.ModifiableTransitionInfo, _ error) (plinko.Payload, error) {
+	return p, nil
+}
+
+func TestHouseRules(t *testing.T) {
+	p := config.CreatePlinkoDefinition(definition.WithLintRules(HouseRules()...))
+	p.InitialState(Created)
+
+	p.Configure(Created, state.WithDescription("A new order.")).
+		OnError(handleError).
+		Permit(Open, Opened).
+		Permit(Cancel, Canceled).
+		PermitReentry(Retry)
+
+	p.Configure(Opened, state.WithSuppressedRules(RequireDescriptionID, RequireErrorHandlerID)).
+		Permit(Cancel, Canceled)
+
+	p.Configure(Canceled, state.WithDescription("A canceled order.")).
+		OnError(handleError).
+		Terminal()
+
+	co := p.Compile()
+
+	assert.Equal(t, []plinko.CompilerMessage{
+		{CompileMessage: plinko.CompileWarning, Message: "State 'Created' reenters itself on Trigger 'Retry' without a guard.", Code: RequireGuardedReentryID},
+		{CompileMessage: plinko.CompileWarning, Message: "Trigger 'cancel' on State 'Created' is not PascalCase.", Code: PascalCaseTriggersID},
+		{CompileMessage: plinko.CompileWarning, Message: "Trigger 'cancel' on State 'Opened' is not PascalCase.", Code: PascalCaseTriggersID},
+	}, co.Messages)
+}
+
+func TestHouseRulesAsErrors(t *testing.T) {
+	p := config.CreatePlinkoDefinition(
+		definition.WithLintRules(RequireDescription(), RequireErrorHandler()),
+		definition.WithWarningsAsErrors(),
+	)
+	p.InitialState(Created)
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened, state.WithDescription("An open order.")).
+		OnError(handleError).
+		Terminal()
+
+	psm, err := p.CompileStrict()
+
+	assert.Nil(t, psm)
+	assert.EqualError(t, err, "2 compile error(s): State 'Created' has no description.; State 'Created' has no OnError handler.")
+}
+
+func TestRequireErrorHandlerAcceptsInheritedHandler(t *testing.T) {
+	p := config.CreatePlinkoDefinition(definition.WithLintRules(RequireErrorHandler()))
+	p.InitialState(Created)
+
+	p.Configure(Active).
+		OnError(handleError)
+
+	p.Configure(Created).
+		Permit(Open, Opened)
+
+	p.Configure(Opened).
+		SubstateOf(Active).
+		Terminal()
+
+	var messages []string
+	for _, m := range p.Compile().Messages {
+		if m.Code == RequireErrorHandlerID {
+			messages = append(messages, m.Message)
+		}
+	}
+
+	assert.Equal(t, []string{"State 'Created' has no OnError handler."}, messages)
+}
@@ -0,0 +1,45 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package render
+
+import "github.com/shipt/plinko"
+
+// WithTitle writes a title above the diagram.
+func WithTitle(title string) func(*plinko.RenderConfig) {
+	return func(c *plinko.RenderConfig) {
+		c.Title = title
+	}
+}
+
+// WithDirection lays the transitions out in the given direction.
+func WithDirection(direction plinko.RenderDirection) func(*plinko.RenderConfig) {
+	return func(c *plinko.RenderConfig) {
+		c.Direction = direction
+	}
+}
+
+// WithStylesheet adds statements in the renderer's own syntax to the diagram header, such as DOT
+// attributes or PlantUML skinparams.
+func WithStylesheet(stylesheet string) func(*plinko.RenderConfig) {
+	return func(c *plinko.RenderConfig) {
+		c.Stylesheet = stylesheet
+	}
+}
+
+// WithDescriptions selects whether state descriptions are drawn, which they are by default.
+func WithDescriptions(include bool) func(*plinko.RenderConfig) {
+	return func(c *plinko.RenderConfig) {
+		c.IncludeDescriptions = include
+	}
+}
+
+// WithHighlight draws the states with an accent color.
+func WithHighlight(states ...plinko.State) func(*plinko.RenderConfig) {
+	return func(c *plinko.RenderConfig) {
+		c.Highlight = append(c.Highlight, states...)
+	}
+}
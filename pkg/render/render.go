@@ -0,0 +1,43 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package render
+
+import (
+	"context"
+	"io"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/internal/renderers"
+)
+
+// NewDot creates a renderer that writes the state machine as a Graphviz digraph.
+func NewDot(w io.Writer, opts ...plinko.RenderOption) plinko.Renderer {
+	return renderers.NewDot(w, opts...)
+}
+
+// NewUML creates a renderer that writes the state machine as a PlantUML state diagram.
+func NewUML(w io.Writer, opts ...plinko.RenderOption) plinko.Renderer {
+	return renderers.NewUML(w, opts...)
+}
+
+// DotToImage runs Graphviz to convert the dot file into an image in the given format, such as "png" or
+// "svg".  The dot command must be on the PATH; it is stopped when the context is done.
+func DotToImage(ctx context.Context, from, to, format string) error {
+	return renderers.DotFileToImg(ctx, from, to, format)
+}
+
+// NewMermaid creates a renderer that writes the state machine as a Mermaid stateDiagram-v2, which GitHub
+// and GitLab render in markdown.
+func NewMermaid(w io.Writer, opts ...plinko.RenderOption) plinko.Renderer {
+	return renderers.NewMermaid(w, opts...)
+}
+
+// NewSCXML creates a renderer that writes the state machine as a W3C SCXML document.  Operations are
+// written as plinko:operation elements and guards as cond attributes, both by name.
+func NewSCXML(w io.Writer, opts ...plinko.RenderOption) plinko.Renderer {
+	return renderers.NewSCXML(w, opts...)
+}
@@ -0,0 +1,83 @@
+package render_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/shipt/plinko"
+	"github.com/shipt/plinko/pkg/config"
+	"github.com/shipt/plinko/pkg/config/state"
+	"github.com/shipt/plinko/pkg/render"
+	"github.com/stretchr/testify/assert"
+)
+
+const Created plinko.State = "Created"
+const Opened plinko.State = "Opened"
+
+func orderDefinition() plinko.PlinkoDefinition {
+	p := config.CreatePlinkoDefinition()
+
+	p.Configure(Created, state.WithDescription("A new order")).
+		Permit("Open", Opened)
+
+	p.Configure(Opened)
+
+	return p
+}
+
+func TestDotOptions(t *testing.T) {
+	buf := bytes.NewBufferString("")
+
+	err := orderDefinition().Render(render.NewDot(buf,
+		render.WithTitle(`Order "v2"`),
+		render.WithDirection(plinko.LeftToRight),
+		render.WithStylesheet("bgcolor=white;"),
+		render.WithDescriptions(false),
+		render.WithHighlight(Opened),
+	))
+
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), "layout=dot;\nrankdir=LR;\n")
+	assert.NotContains(t, buf.String(), "layout=fdp;")
+	assert.Contains(t, buf.String(), "label=\"Order \\\"v2\\\"\";\nlabelloc=\"t\";\n")
+	assert.Contains(t, buf.String(), "bgcolor=white;\n")
+	assert.NotContains(t, buf.String(), "A new order")
+	assert.Contains(t, buf.String(), `"Opened" [label=<<TABLE STYLE="ROUNDED" BGCOLOR="lightblue"`)
+	assert.Contains(t, buf.String(), `"Created" [label=<<TABLE STYLE="ROUNDED" BGCOLOR="orange"`)
+}
+
+func TestDotDefaults(t *testing.T) {
+	buf := bytes.NewBufferString("")
+
+	err := orderDefinition().Render(render.NewDot(buf))
+
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), "layout=fdp;")
+	assert.Contains(t, buf.String(), `<TR><TD BORDER="1" SIDES="t">A new order</TD></TR>`)
+}
+
+func TestUMLOptions(t *testing.T) {
+	buf := bytes.NewBufferString("")
+
+	err := orderDefinition().Render(render.NewUML(buf,
+		render.WithTitle("Orders"),
+		render.WithDirection(plinko.LeftToRight),
+		render.WithStylesheet("skinparam monochrome true"),
+		render.WithHighlight(Opened),
+	))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "@startuml\ntitle Orders\nleft to right direction\nskinparam monochrome true\n"+
+		"Created : A new order\nstate Opened #LightBlue\n"+
+		"[*] -> Created \nCreated --> Opened : Open\n@enduml", buf.String())
+}
+
+func TestDotToImageStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := render.DotToImage(ctx, "-graph.dot", "graph.png", "png")
+
+	assert.NotNil(t, err)
+}
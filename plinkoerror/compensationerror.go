@@ -0,0 +1,51 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package plinkoerror
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shipt/plinko"
+)
+
+// CompensationFailure describes a compensating operation that failed while undoing a completed step.
+type CompensationFailure struct {
+	StepNumber int
+	StepName   string
+	Err        error
+}
+
+// PlinkoCompensationError is raised when a chain step fails and one or more of the compensations for the
+// steps that completed before it fail as well.  InnerError is the failure that triggered the compensation,
+// and Failures lists the compensations that didn't succeed in the order they ran.
+type PlinkoCompensationError struct {
+	plinko.TransitionInfo
+	InnerError error
+	Failures   []CompensationFailure
+}
+
+func (e *PlinkoCompensationError) Error() string {
+	var failures []string
+	for _, f := range e.Failures {
+		failures = append(failures, fmt.Sprintf("step %d (%s): %s", f.StepNumber, f.StepName, f.Err))
+	}
+
+	return fmt.Sprintf("%s; compensation failed for %s", e.InnerError, strings.Join(failures, ", "))
+}
+
+func (e *PlinkoCompensationError) Unwrap() error {
+	return e.InnerError
+}
+
+func CreatePlinkoCompensationError(inner error, t plinko.TransitionInfo, failures []CompensationFailure) error {
+	return &PlinkoCompensationError{
+		TransitionInfo: t,
+		InnerError:     inner,
+		Failures:       failures,
+	}
+}
@@ -0,0 +1,29 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package plinkoerror
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreatePlinkoCompensationError(t *testing.T) {
+	cause := errors.New("card declined")
+	err := CreatePlinkoCompensationError(cause, testTransition{destination: "a"}, []CompensationFailure{
+		{StepNumber: 1, StepName: "ChargeCard", Err: errors.New("refund failed")},
+		{StepNumber: 0, StepName: "ReserveInventory", Err: errors.New("release failed")},
+	})
+
+	var e *PlinkoCompensationError
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Len(t, e.Failures, 2)
+		assert.Equal(t, "card declined; compensation failed for step 1 (ChargeCard): refund failed, step 0 (ReserveInventory): release failed", e.Error())
+	}
+	assert.True(t, errors.Is(err, cause))
+}
@@ -0,0 +1,49 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package plinkoerror
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shipt/plinko"
+)
+
+// PlinkoCompileError is returned by CompileStrict when the definition has compile errors.  Messages
+// holds every message the compiler reported, warnings included.
+type PlinkoCompileError struct {
+	Messages []plinko.CompilerMessage
+}
+
+func (e *PlinkoCompileError) Error() string {
+	errs := e.Errors()
+
+	messages := make([]string, 0, len(errs))
+	for _, m := range errs {
+		messages = append(messages, m.Message)
+	}
+
+	return fmt.Sprintf("%d compile error(s): %s", len(errs), strings.Join(messages, "; "))
+}
+
+// Errors returns the messages reported as compile errors.
+func (e *PlinkoCompileError) Errors() []plinko.CompilerMessage {
+	var errs []plinko.CompilerMessage
+	for _, m := range e.Messages {
+		if m.CompileMessage == plinko.CompileError {
+			errs = append(errs, m)
+		}
+	}
+
+	return errs
+}
+
+func CreatePlinkoCompileError(messages []plinko.CompilerMessage) error {
+	return &PlinkoCompileError{
+		Messages: messages,
+	}
+}
@@ -0,0 +1,30 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package plinkoerror
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shipt/plinko"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreatePlinkoCompileError(t *testing.T) {
+	err := CreatePlinkoCompileError([]plinko.CompilerMessage{
+		{CompileMessage: plinko.CompileError, Message: "State 'a' undefined.", Code: plinko.UndefinedStateCode},
+		{CompileMessage: plinko.CompileWarning, Message: "State 'b' is a dead end.", Code: plinko.DeadEndStateCode},
+		{CompileMessage: plinko.CompileError, Message: "State 'c' is its own superstate.", Code: plinko.SuperstateCycleCode},
+	})
+
+	var e *PlinkoCompileError
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Len(t, e.Messages, 3)
+		assert.Len(t, e.Errors(), 2)
+		assert.Equal(t, "2 compile error(s): State 'a' undefined.; State 'c' is its own superstate.", e.Error())
+	}
+}
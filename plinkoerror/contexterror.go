@@ -0,0 +1,45 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package plinkoerror
+
+import (
+	"fmt"
+
+	"github.com/shipt/plinko"
+)
+
+// PlinkoContextError is raised when the context of a Fire call is canceled or its deadline passes while
+// the transition is running.  StepNumber and StepName identify the step that was not executed, and
+// InnerError holds the context's error so errors.Is(err, context.DeadlineExceeded) distinguishes a
+// timeout from a cancellation.
+type PlinkoContextError struct {
+	plinko.TransitionInfo
+	StepNumber int
+	StepName   string
+	InnerError error
+}
+
+func (e *PlinkoContextError) Error() string {
+	if e.StepName == "" {
+		return fmt.Sprintf("transition stopped: %s", e.InnerError)
+	}
+
+	return fmt.Sprintf("transition stopped before step %d (%s): %s", e.StepNumber, e.StepName, e.InnerError)
+}
+
+func (e *PlinkoContextError) Unwrap() error {
+	return e.InnerError
+}
+
+func CreatePlinkoContextError(inner error, t plinko.TransitionInfo, step int, name string) error {
+	return &PlinkoContextError{
+		TransitionInfo: t,
+		StepNumber:     step,
+		StepName:       name,
+		InnerError:     inner,
+	}
+}
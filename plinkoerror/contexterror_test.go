@@ -0,0 +1,31 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package plinkoerror
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreatePlinkoContextError(t *testing.T) {
+	err := CreatePlinkoContextError(context.DeadlineExceeded, testTransition{destination: "a"}, 2, "ReserveInventory")
+
+	var e *PlinkoContextError
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, 2, e.StepNumber)
+		assert.Equal(t, "ReserveInventory", e.StepName)
+		assert.Equal(t, "transition stopped before step 2 (ReserveInventory): context deadline exceeded", e.Error())
+	}
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	err = CreatePlinkoContextError(context.Canceled, nil, 0, "")
+	assert.Equal(t, "transition stopped: context canceled", err.Error())
+	assert.True(t, errors.Is(err, context.Canceled))
+}
@@ -0,0 +1,78 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package plinkoerror
+
+import (
+	"errors"
+
+	"github.com/shipt/plinko"
+)
+
+// PlinkoGuardError is returned when a trigger declared with several guarded permits on a state cannot
+// select exactly one of them.  Destinations lists the permits whose guards passed; it is empty when no
+// guard passed and holds more than one state when the guards are not mutually exclusive.  The unguarded
+// permit, which is taken when no guard passes, is never listed.  When no guard passed, Causes holds the
+// errors of the failing guards in declaration order, and errors.Is and errors.As look through each of them.
+type PlinkoGuardError struct {
+	plinko.Trigger
+	State        plinko.State
+	Destinations []plinko.State
+	Causes       []error
+	ErrorMessage string
+}
+
+func (e *PlinkoGuardError) Error() string {
+	return e.ErrorMessage
+}
+
+// Unwrap returns the first cause; Is and As consider the others as well.
+func (e *PlinkoGuardError) Unwrap() error {
+	if len(e.Causes) == 0 {
+		return nil
+	}
+
+	return e.Causes[0]
+}
+
+func (e *PlinkoGuardError) Is(target error) bool {
+	for _, cause := range e.Causes {
+		if errors.Is(cause, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *PlinkoGuardError) As(target interface{}) bool {
+	for _, cause := range e.Causes {
+		if errors.As(cause, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func CreatePlinkoGuardError(trigger plinko.Trigger, state plinko.State, destinations []plinko.State, errorMessage string) error {
+	return &PlinkoGuardError{
+		Trigger:      trigger,
+		State:        state,
+		Destinations: destinations,
+		ErrorMessage: errorMessage,
+	}
+}
+
+// WrapPlinkoGuardError reports that no guard passed, keeping the errors of the failing guards.
+func WrapPlinkoGuardError(trigger plinko.Trigger, state plinko.State, causes []error, errorMessage string) error {
+	return &PlinkoGuardError{
+		Trigger:      trigger,
+		State:        state,
+		Causes:       causes,
+		ErrorMessage: errorMessage,
+	}
+}
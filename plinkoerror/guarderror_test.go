@@ -0,0 +1,49 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package plinkoerror
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shipt/plinko"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreatePlinkoGuardError(t *testing.T) {
+	var e *PlinkoGuardError
+	err := CreatePlinkoGuardError("foo", "bar", []plinko.State{"a", "b"}, "set")
+	if errors.As(err, &e) {
+		assert.Equal(t, plinko.Trigger("foo"), e.Trigger)
+		assert.Equal(t, plinko.State("bar"), e.State)
+		assert.Equal(t, []plinko.State{"a", "b"}, e.Destinations)
+		assert.Equal(t, "set", e.Error())
+	} else {
+		assert.Fail(t, "error not returning properly")
+	}
+}
+
+func TestWrapPlinkoGuardError(t *testing.T) {
+	notCurbside := errors.New("not curbside")
+	inStore := &PlinkoStateError{State: "InStore"}
+
+	err := WrapPlinkoGuardError("foo", "bar", []error{notCurbside, inStore}, "none")
+
+	var pge *PlinkoGuardError
+	if assert.True(t, errors.As(err, &pge)) {
+		assert.Equal(t, []error{notCurbside, inStore}, pge.Causes)
+		assert.Empty(t, pge.Destinations)
+	}
+	assert.True(t, errors.Is(err, notCurbside))
+	assert.Equal(t, notCurbside, errors.Unwrap(err))
+
+	var pse *PlinkoStateError
+	assert.True(t, errors.As(err, &pse))
+	assert.Equal(t, plinko.State("InStore"), pse.State)
+
+	assert.False(t, errors.Is(CreatePlinkoGuardError("foo", "bar", nil, "none"), notCurbside))
+}
@@ -0,0 +1,63 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package plinkoerror
+
+import (
+	"fmt"
+
+	"github.com/shipt/plinko"
+)
+
+// PlinkoRedirectError is returned from Fire when an OnError handler moved the transition to a
+// different destination and that destination was entered successfully.  The embedded
+// TransitionInfo describes where the payload finally landed, and InnerError holds the failure
+// that caused the redirect.
+type PlinkoRedirectError struct {
+	plinko.TransitionInfo
+	OriginalDestination plinko.State
+	InnerError          error
+}
+
+func (e *PlinkoRedirectError) Error() string {
+	return fmt.Sprintf("transition redirected from '%s' to '%s': %s", e.OriginalDestination, e.GetDestination(), e.InnerError)
+}
+
+func (e *PlinkoRedirectError) Unwrap() error {
+	return e.InnerError
+}
+
+func CreatePlinkoRedirectError(t plinko.TransitionInfo, originalDestination plinko.State, inner error) error {
+	return &PlinkoRedirectError{
+		TransitionInfo:      t,
+		OriginalDestination: originalDestination,
+		InnerError:          inner,
+	}
+}
+
+// PlinkoRedirectLoopError is returned from Fire when OnError handlers redirect a transition
+// back to a state that was already attempted during the same Fire call.
+type PlinkoRedirectLoopError struct {
+	plinko.TransitionInfo
+	States     []plinko.State
+	InnerError error
+}
+
+func (e *PlinkoRedirectLoopError) Error() string {
+	return fmt.Sprintf("redirect loop detected entering '%s' (visited %v): %s", e.GetDestination(), e.States, e.InnerError)
+}
+
+func (e *PlinkoRedirectLoopError) Unwrap() error {
+	return e.InnerError
+}
+
+func CreatePlinkoRedirectLoopError(t plinko.TransitionInfo, states []plinko.State, inner error) error {
+	return &PlinkoRedirectLoopError{
+		TransitionInfo: t,
+		States:         states,
+		InnerError:     inner,
+	}
+}
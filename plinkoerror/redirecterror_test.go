@@ -0,0 +1,49 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package plinkoerror
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shipt/plinko"
+	"github.com/stretchr/testify/assert"
+)
+
+type testTransition struct {
+	destination plinko.State
+}
+
+func (t testTransition) GetSource() plinko.State      { return "source" }
+func (t testTransition) GetDestination() plinko.State { return t.destination }
+func (t testTransition) GetTrigger() plinko.Trigger   { return "trigger" }
+func (t testTransition) GetArgs() []interface{}       { return nil }
+
+func TestCreatePlinkoRedirectError(t *testing.T) {
+	inner := errors.New("inner")
+	err := CreatePlinkoRedirectError(testTransition{destination: "triage"}, "good", inner)
+
+	var e *PlinkoRedirectError
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, plinko.State("triage"), e.GetDestination())
+		assert.Equal(t, plinko.State("good"), e.OriginalDestination)
+		assert.Equal(t, "transition redirected from 'good' to 'triage': inner", e.Error())
+	}
+	assert.True(t, errors.Is(err, inner))
+}
+
+func TestCreatePlinkoRedirectLoopError(t *testing.T) {
+	inner := errors.New("inner")
+	err := CreatePlinkoRedirectLoopError(testTransition{destination: "a"}, []plinko.State{"a", "b"}, inner)
+
+	var e *PlinkoRedirectLoopError
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, []plinko.State{"a", "b"}, e.States)
+		assert.Equal(t, "redirect loop detected entering 'a' (visited [a b]): inner", e.Error())
+	}
+	assert.True(t, errors.Is(err, inner))
+}
@@ -0,0 +1,49 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package plinkoerror
+
+import (
+	"fmt"
+
+	"github.com/shipt/plinko"
+)
+
+// PlinkoRetryError is raised when a step configured with a retry policy still fails after being attempted
+// more than once.  Attempts is the number of times the step ran and InnerError is the cause of the last
+// failure.  Attempts is less than MaxAttempts when the last failure was not retryable.
+type PlinkoRetryError struct {
+	plinko.TransitionInfo
+	StepNumber  int
+	StepName    string
+	Attempts    int
+	MaxAttempts int
+	InnerError  error
+}
+
+func (e *PlinkoRetryError) Error() string {
+	return fmt.Sprintf("step %d (%s) failed after %d of %d attempts: %s", e.StepNumber, e.StepName, e.Attempts, e.MaxAttempts, e.InnerError)
+}
+
+func (e *PlinkoRetryError) Unwrap() error {
+	return e.InnerError
+}
+
+// Exhausted reports whether every permitted attempt was used.
+func (e *PlinkoRetryError) Exhausted() bool {
+	return e.Attempts >= e.MaxAttempts
+}
+
+func CreatePlinkoRetryError(inner error, t plinko.TransitionInfo, step int, name string, attempts int, maxAttempts int) error {
+	return &PlinkoRetryError{
+		TransitionInfo: t,
+		StepNumber:     step,
+		StepName:       name,
+		Attempts:       attempts,
+		MaxAttempts:    maxAttempts,
+		InnerError:     inner,
+	}
+}
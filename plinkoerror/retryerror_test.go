@@ -0,0 +1,31 @@
+/**
+ * Copyright (c) Shipt.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+package plinkoerror
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreatePlinkoRetryError(t *testing.T) {
+	cause := errors.New("inventory service unavailable")
+	err := CreatePlinkoRetryError(cause, testTransition{destination: "a"}, 1, "ReserveInventory", 3, 3)
+
+	var e *PlinkoRetryError
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, 3, e.Attempts)
+		assert.True(t, e.Exhausted())
+		assert.Equal(t, "step 1 (ReserveInventory) failed after 3 of 3 attempts: inventory service unavailable", e.Error())
+	}
+	assert.True(t, errors.Is(err, cause))
+
+	err = CreatePlinkoRetryError(cause, nil, 0, "", 2, 5)
+	assert.True(t, errors.As(err, &e))
+	assert.False(t, e.Exhausted())
+}
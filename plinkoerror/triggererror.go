@@ -11,15 +11,30 @@ import "github.com/shipt/plinko"
 type PlinkoTriggerError struct {
 	plinko.Trigger
 	ErrorMessage string
+	// InnerError holds the cause of the error when there is one, such as the error of a failing guard.
+	InnerError error
 }
 
 func (e *PlinkoTriggerError) Error() string {
 	return e.ErrorMessage
 }
 
+func (e *PlinkoTriggerError) Unwrap() error {
+	return e.InnerError
+}
+
 func CreatePlinkoTriggerError(trigger plinko.Trigger, errorMessage string) error {
 	return &PlinkoTriggerError{
 		Trigger:      trigger,
 		ErrorMessage: errorMessage,
 	}
 }
+
+// WrapPlinkoTriggerError creates a PlinkoTriggerError that keeps the error that caused it.
+func WrapPlinkoTriggerError(trigger plinko.Trigger, inner error, errorMessage string) error {
+	return &PlinkoTriggerError{
+		Trigger:      trigger,
+		ErrorMessage: errorMessage,
+		InnerError:   inner,
+	}
+}
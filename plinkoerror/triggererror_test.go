@@ -25,3 +25,14 @@ func TestCreatePlinkoTriggerError(t *testing.T) {
 		assert.Fail(t, "error not returning properly")
 	}
 }
+
+func TestWrapPlinkoTriggerError(t *testing.T) {
+	cause := errors.New("order has no items")
+	err := WrapPlinkoTriggerError("foo", cause, "set")
+
+	var e *PlinkoTriggerError
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, "set", e.Error())
+	}
+	assert.True(t, errors.Is(err, cause))
+}